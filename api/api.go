@@ -6,10 +6,14 @@
 package api
 
 import (
+	"bytes"
+	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/denro/nordnet/util"
 	. "github.com/denro/nordnet/util/models"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -21,6 +25,7 @@ const (
 	NNBASEURL    = `https://www.nordnet.se/next`
 	NNSERVICE    = `NEXTAPI`
 	NNAPIVERSION = `2`
+	NNLANGUAGE   = `en`
 )
 
 var (
@@ -41,11 +46,53 @@ func (e APIError) Error() string {
 // Represents the options available for various methods.
 type Params map[string]string
 
+// Returns the params URL encoded and sorted by key.
+func (p Params) Encode() string {
+	values := url.Values{}
+	for key, value := range p {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
 // APIClient provides all API-endpoints available as methods.
 type APIClient struct {
 	URL, Service, Version, Credentials, SessionKey string
 	ExpiresAt, LastUsageAt                         time.Time
 
+	// Name of the environment preset in use (empty unless set from a preset), and the Accept-Language and User-Agent sent with every request
+	Environment, Language, UserAgent string
+
+	// Optional hooks around every request, see the With* options
+	RateLimiter RateLimiter
+	RetryPolicy RetryPolicy
+	Logger      Logger
+	Clock       Clock
+	Sleeper     Sleeper
+	Middleware  []Middleware
+
+	// Called with the meta of every response, including those of the typed endpoint methods
+	ResponseHook func(*ResponseMeta)
+
+	// Ids per request and concurrent requests used by the batch lookups, see WithBatching
+	BatchSize, BatchParallelism int
+
+	// When set, Login asks the provider for fresh credentials instead of using Credentials
+	Provider util.CredentialProvider
+
+	// When set, Login uses the challenge-response flow with the registered API key instead of credentials
+	APIKey     string
+	PrivateKey crypto.Signer
+
+	// Stamp the credentials with the server time instead of the local clock, requires a util.TimedCredentialProvider
+	CompensateSkew bool
+
+	skew         time.Duration
+	skewMeasured bool
+
+	// Set by WithCassette, always wraps the transport directly
+	cassette Middleware
+
 	http.Client
 	sync.RWMutex
 }
@@ -56,225 +103,213 @@ func NewAPIClient(credentials string) *APIClient {
 		URL:         NNBASEURL,
 		Service:     NNSERVICE,
 		Version:     NNAPIVERSION,
+		Language:    NNLANGUAGE,
 		Credentials: credentials,
 	}
 }
 
+// Constructor function takes a provider that generates new credentials on every login.
+func NewAPIClientWithProvider(provider util.CredentialProvider) *APIClient {
+	client := NewAPIClient("")
+	client.Provider = provider
+	return client
+}
+
 // Information about the system status can be retrieved by this HTTP request. This is the only service that can be called without authentication.
 func (c *APIClient) SystemStatus() (res *SystemStatus, err error) {
 	res = &SystemStatus{}
-	err = c.Perform("GET", "", nil, res)
+	*res, _, err = Do[SystemStatus](c, "GET", "", nil)
 	return
 }
 
 // Returns a list of accounts that the user has access to.
 func (c *APIClient) Accounts() (res []Account, err error) {
-	res = []Account{}
-	err = c.Perform("GET", "accounts", nil, &res)
+	res, _, err = Do[[]Account](c, "GET", "accounts", nil)
 	return
 }
 
 // The account summary gives details of the account.
 func (c *APIClient) Account(accountno int64) (res *AccountInfo, err error) {
 	res = &AccountInfo{}
-	err = c.Perform("GET", fmt.Sprintf("accounts/%d", accountno), nil, res)
+	*res, _, err = Do[AccountInfo](c, "GET", fmt.Sprintf("accounts/%d", accountno), nil)
 	return
 }
 
 // Information about the currency ledgers of an account.
 func (c *APIClient) AccountLedgers(accountno int64) (res []LedgerInformation, err error) {
-	res = []LedgerInformation{}
-	err = c.Perform("GET", fmt.Sprintf("accounts/%d/ledgers", accountno), nil, &res)
+	res, _, err = Do[[]LedgerInformation](c, "GET", fmt.Sprintf("accounts/%d/ledgers", accountno), nil)
 	return
 }
 
 // Get all orders beloning to an account.
 func (c *APIClient) AccountOrders(accountno int64, params *Params) (res []Order, err error) {
-	res = []Order{}
-	err = c.Perform("GET", fmt.Sprintf("accounts/%d/orders", accountno), params, &res)
+	res, _, err = Do[[]Order](c, "GET", fmt.Sprintf("accounts/%d/orders", accountno), params)
 	return
 }
 
 // Enter a new order, market_id + identifier is the identifier of the tradable.
 func (c *APIClient) CreateOrder(accountno int64, params *Params) (res *OrderReply, err error) {
 	res = &OrderReply{}
-	err = c.Perform("POST", fmt.Sprintf("accounts/%d/orders", accountno), params, res)
+	*res, _, err = Do[OrderReply](c, "POST", fmt.Sprintf("accounts/%d/orders", accountno), params)
 	return
 }
 
 // Activate an inactive order. Please note that it is not possible to deactivate an order. The order must be entered as inactive.
 func (c *APIClient) ActivateOrder(accountno int64, orderId int64) (res *OrderReply, err error) {
 	res = &OrderReply{}
-	err = c.Perform("PUT", fmt.Sprintf("accounts/%d/orders/%d/activate", accountno, orderId), nil, res)
+	*res, _, err = Do[OrderReply](c, "PUT", fmt.Sprintf("accounts/%d/orders/%d/activate", accountno, orderId), nil)
 	return
 }
 
 // Modify price and or volume on an order.
 func (c *APIClient) UpdateOrder(accountno int64, orderId int64, params *Params) (res *OrderReply, err error) {
 	res = &OrderReply{}
-	err = c.Perform("PUT", fmt.Sprintf("accounts/%d/orders/%d", accountno, orderId), params, res)
+	*res, _, err = Do[OrderReply](c, "PUT", fmt.Sprintf("accounts/%d/orders/%d", accountno, orderId), params)
 	return
 }
 
 // Delete an order.
 func (c *APIClient) DeleteOrder(accountno int64, orderId int64) (res *OrderReply, err error) {
 	res = &OrderReply{}
-	err = c.Perform("DELETE", fmt.Sprintf("accounts/%d/orders/%d", accountno, orderId), nil, res)
+	*res, _, err = Do[OrderReply](c, "DELETE", fmt.Sprintf("accounts/%d/orders/%d", accountno, orderId), nil)
 	return
 }
 
 // Returns a list of all positions of the account.
 func (c *APIClient) AccountPositions(accountno int64) (res []Position, err error) {
-	res = []Position{}
-	err = c.Perform("GET", fmt.Sprintf("accounts/%d/positions", accountno), nil, &res)
+	res, _, err = Do[[]Position](c, "GET", fmt.Sprintf("accounts/%d/positions", accountno), nil)
 	return
 }
 
 // Get all trades belonging to an account.
 func (c *APIClient) AccountTrades(accountno int64, params *Params) (res []Trade, err error) {
-	res = []Trade{}
-	err = c.Perform("GET", fmt.Sprintf("accounts/%d/trades", accountno), params, &res)
+	res, _, err = Do[[]Trade](c, "GET", fmt.Sprintf("accounts/%d/trades", accountno), params)
 	return
 }
 
 // Get a list of all countries in the system. Please note that trading is not available everywhere.
 func (c *APIClient) Countries() (res []Country, err error) {
-	res = []Country{}
-	c.Perform("GET", "countries", nil, &res)
-	return
-}
-
-// Lookup one or more countries by country code. Multiple countries can be queried at the same time by comma separating the country codes.
-// TODO: Merge with Countries call above?
-func (c *APIClient) LookupCountries(countries string) (res []Country, err error) {
-	res = []Country{}
-	err = c.Perform("GET", fmt.Sprintf("countries/%s", countries), nil, &res)
+	res, _, err = Do[[]Country](c, "GET", "countries", nil)
 	return
 }
 
 // Returns a list indicators that the user has access to.
 func (c *APIClient) Indicators() (res []Indicator, err error) {
-	res = []Indicator{}
-	err = c.Perform("GET", "indicators", nil, &res)
-	return
-}
-
-// Returns info of one or more indicators.
-// TODO: Merge with Indicators call above?
-func (c *APIClient) LookupIndicators(indicators string) (res []Indicator, err error) {
-	res = []Indicator{}
-	err = c.Perform("GET", fmt.Sprintf("indicators/%s", indicators), nil, &res)
+	res, _, err = Do[[]Indicator](c, "GET", "indicators", nil)
 	return
 }
 
 // Free text search. A list of instruments is returned.
 func (c *APIClient) SearchInstruments(params *Params) (res []Instrument, err error) {
-	res = []Instrument{}
-	err = c.Perform("GET", "instruments", params, &res)
-	return
-}
-
-// Get one or more instruments, the instrument id is used as key
-func (c *APIClient) Instruments(ids string) (res []Instrument, err error) {
-	res = []Instrument{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/%s", ids), nil, &res)
+	res, _, err = Do[[]Instrument](c, "GET", "instruments", params)
 	return
 }
 
 // Returns a list of leverage instruments that have the current instrument as underlying. Leverage instruments is for example warrants and ETF:s. To get all valid filters for the current underlying please use "Get leverages filters". The filters can be used to narrow the search. If "Get leverages filters" is used to fill comboboxes the same filters can be applied on the that call to hide filter cominations that are not valid. Multiple filters can be applied.
 func (c *APIClient) InstrumentLeverages(id int64, params *Params) (res []Instrument, err error) {
-	res = []Instrument{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/%d/leverages", id), params, &res)
+	res, _, err = Do[[]Instrument](c, "GET", fmt.Sprintf("instruments/%d/leverages", id), params)
 	return
 }
 
 // Returns valid filter values. Can be used to fill comboboxes in clients to filter leverages results. The same filters can be applied on this request to exclude invalid filter combinations.
 func (c *APIClient) InstrumentLeverageFilters(id int64, params *Params) (res *LeverageFilter, err error) {
 	res = &LeverageFilter{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/%d/leverages/filters", id), params, res)
+	*res, _, err = Do[LeverageFilter](c, "GET", fmt.Sprintf("instruments/%d/leverages/filters", id), params)
 	return
 }
 
 // Returns a list of call/put option pairs. They are balanced on strike price. In order to find underlyings with options use "Get underlyings". To get available expiration dates use "Get option pair filters".
 func (c *APIClient) InstrumentOptionPairs(id int64, params *Params) (res []OptionPair, err error) {
-	res = []OptionPair{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/%d/option_pairs", id), params, &res)
+	res, _, err = Do[[]OptionPair](c, "GET", fmt.Sprintf("instruments/%d/option_pairs", id), params)
 	return
 }
 
 // Returns valid filter values. Can be used to fill comboboxes in clients to filter options pair results. The same filters can be applied on this request to exclude invalid filter combinations.
 func (c *APIClient) InstrumentOptionPairFilters(id int64, params *Params) (res *OptionPairFilter, err error) {
 	res = &OptionPairFilter{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/%d/option_pairs/filters", id), params, res)
+	*res, _, err = Do[OptionPairFilter](c, "GET", fmt.Sprintf("instruments/%d/option_pairs/filters", id), params)
 	return
 }
 
 // Lookup specfic instrument with prededfined fields. Please note that this is not a search, only exact matches is returned.
 func (c *APIClient) InstrumentLookup(lookupType string, lookup string) (res []Instrument, err error) {
-	res = []Instrument{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/lookup/%s/%s", lookupType, lookup), nil, &res)
+	res, _, err = Do[[]Instrument](c, "GET", fmt.Sprintf("instruments/lookup/%s/%s", lookupType, lookup), nil)
 	return
 }
 
 // Get all instrument sectors or the ones matching the group crtieria
 func (c *APIClient) InstrumentSectors(params *Params) (res []Sector, err error) {
-	res = []Sector{}
-	err = c.Perform("GET", "instruments/sectors", params, &res)
+	res, _, err = Do[[]Sector](c, "GET", "instruments/sectors", params)
 	return
 }
 
 // Get one or more sectors
 func (c *APIClient) InstrumentSector(sectors string) (res []Sector, err error) {
-	res = []Sector{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/sectors/%s", sectors), nil, &res)
+	res, _, err = Do[[]Sector](c, "GET", fmt.Sprintf("instruments/sectors/%s", sectors), nil)
 	return
 }
 
 // Get all instrument types. Please note that these types is used for both instrument_type and instrument_group_type.
 func (c *APIClient) InstrumentTypes() (res []InstrumentType, err error) {
-	res = []InstrumentType{}
-	err = c.Perform("GET", "instruments/types", nil, &res)
+	res, _, err = Do[[]InstrumentType](c, "GET", "instruments/types", nil)
 	return
 }
 
 // Get info of one orde more instrument type.
 func (c *APIClient) InstrumentType(instrumentType string) (res []InstrumentType, err error) {
-	res = []InstrumentType{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/types/%s", instrumentType), nil, &res)
+	res, _, err = Do[[]InstrumentType](c, "GET", fmt.Sprintf("instruments/types/%s", instrumentType), nil)
 	return
 }
 
 // Get instruments that are underlyings for a specific type of instruments. The query can return instrument that have option derivatives or leverage derivatives. Warrants are included in the leverage derivatives.
 func (c *APIClient) InstrumentUnderlyings(derivateType string, currency string) (res []Instrument, err error) {
-	res = []Instrument{}
-	err = c.Perform("GET", fmt.Sprintf("instruments/underlyings/%s/%s", derivateType, currency), nil, &res)
+	res, _, err = Do[[]Instrument](c, "GET", fmt.Sprintf("instruments/underlyings/%s/%s", derivateType, currency), nil)
 	return
 }
 
 // Get all instrument lists
 func (c *APIClient) Lists() (res []List, err error) {
-	res = []List{}
-	err = c.Perform("GET", "lists", nil, &res)
+	res, _, err = Do[[]List](c, "GET", "lists", nil)
 	return
 }
 
 // Get all instruments in a list.
 func (c *APIClient) List(id int64) (res []Instrument, err error) {
-	res = []Instrument{}
-	err = c.Perform("GET", fmt.Sprintf("lists/%d", id), nil, &res)
+	res, _, err = Do[[]Instrument](c, "GET", fmt.Sprintf("lists/%d", id), nil)
 	return
 }
 
 // Before any other of the services (except for the system info request) can be called the user must login. The username, password and phrase must be sent encrypted.
 // TODO: move the params into function arguments since its only used here?
 func (c *APIClient) Login() (res *Login, err error) {
-	res = &Login{}
-
 	c.RLock()
-	params := &Params{"auth": c.Credentials, "service": c.Service}
+	provider, compensate, key := c.Provider, c.CompensateSkew, c.PrivateKey
 	c.RUnlock()
 
-	err = c.Perform("POST", "login", params, res)
+	if key != nil {
+		return c.KeyLogin()
+	}
+
+	res = &Login{}
+
+	if provider != nil {
+		if err = c.refreshCredentials(provider); err != nil {
+			return
+		}
+	}
+
+	err = c.login(res)
+
+	// The skew may have changed since it was measured, measure again and retry once
+	if isInvalidTimestamp(err) && provider != nil && compensate {
+		if _, err = c.MeasureClockSkew(); err != nil {
+			return
+		}
+		if err = c.refreshCredentials(provider); err != nil {
+			return
+		}
+		err = c.login(res)
+	}
 
 	c.Lock()
 	c.SessionKey = res.SessionKey
@@ -283,158 +318,265 @@ func (c *APIClient) Login() (res *Login, err error) {
 	return
 }
 
+func (c *APIClient) login(res *Login) error {
+	c.RLock()
+	params := &Params{"auth": c.Credentials, "service": c.Service}
+	c.RUnlock()
+
+	return c.Perform("POST", "login", params, res)
+}
+
 // Invalidates the session.
 func (c *APIClient) Logout() (res *LoggedInStatus, err error) {
 	res = &LoggedInStatus{}
-	err = c.Perform("DELETE", "login", nil, res)
+	*res, _, err = Do[LoggedInStatus](c, "DELETE", "login", nil)
 	return
 }
 
 // If the application needs to keep the session alive the session can be touched. Note the basic auth header field must be set as for all other calls. All calls to any REST service is touching the session. So touching the session manually is only needed if no other calls are done during the session timeout interval.
 func (c *APIClient) Touch() (res *LoggedInStatus, err error) {
 	res = &LoggedInStatus{}
-	err = c.Perform("PUT", "login", nil, res)
+	*res, _, err = Do[LoggedInStatus](c, "PUT", "login", nil)
 	return
 }
 
 //Get all tradable markets. Market 80 is the smart order market. Instruments that can be traded on 2 or more markets gets a tradable on the smart order market. Orders entered with the smart order tradable get smart order routed with the current Nordnet best execution policy.
 func (c *APIClient) Markets() (res []Market, err error) {
-	res = []Market{}
-	err = c.Perform("GET", "markets", nil, &res)
-	return
-}
-
-// Lookup one or more markets by market_id. Multiple market can be queried at the same time by comma separating the market_ids. Market 80 is the smart order market. Instruments that can be traded on 2 or more markets gets a tradable on the smart order market. Orders entered with the smart order tradable get smart order routed with the current Nordnet best execution policy.
-func (c *APIClient) Market(ids string) (res []Market, err error) {
-	res = []Market{}
-	err = c.Perform("GET", fmt.Sprintf("markets/%s", ids), nil, &res)
+	res, _, err = Do[[]Market](c, "GET", "markets", nil)
 	return
 }
 
 // Search for news. If no search field is used the last news available to the user is returned.
 func (c *APIClient) SearchNews(params *Params) (res []NewsPreview, err error) {
-	res = []NewsPreview{}
-	err = c.Perform("GET", "news", params, &res)
+	res, _, err = Do[[]NewsPreview](c, "GET", "news", params)
 	return
 }
 
-// Show one or more news items.
-// Search for news. If no search field is used the last news available to the user is returned.
-func (c *APIClient) News(ids string) (res []NewsItem, err error) {
-	res = []NewsItem{}
-	err = c.Perform("GET", fmt.Sprintf("news/%s", ids), nil, &res)
-	return res, nil
-}
-
 // Returns a list of news sources the user has access to
 func (c *APIClient) NewsSources() (res []NewsSource, err error) {
-	res = []NewsSource{}
-	err = c.Perform("GET", "news_sources", nil, &res)
+	res, _, err = Do[[]NewsSource](c, "GET", "news_sources", nil)
 	return
 }
 
 // Get realtime data access. This applies to the access on the feeds. If the market is missing the user don't have realtime access on that market.
 func (c *APIClient) RealtimeAccess() (res []RealtimeAccess, err error) {
-	res = []RealtimeAccess{}
-	err = c.Perform("GET", "realtime_access", nil, &res)
+	res, _, err = Do[[]RealtimeAccess](c, "GET", "realtime_access", nil)
 	return
 }
 
 // Get all ticksize tables.
 func (c *APIClient) TickSizes() (res []TicksizeTable, err error) {
-	res = []TicksizeTable{}
-	err = c.Perform("GET", "tick_sizes", nil, &res)
+	res, _, err = Do[[]TicksizeTable](c, "GET", "tick_sizes", nil)
 	return
 }
 
-// Get one or more ticksize tables.
-func (c *APIClient) TickSize(ids string) (res []TicksizeTable, err error) {
-	res = []TicksizeTable{}
-	err = c.Perform("GET", fmt.Sprintf("tick_sizes/%s", ids), nil, &res)
+// Sends the request and decodes the JSON response into res. Params are sent in the query string for
+// GET and DELETE, and as a form encoded body for other methods, so credentials and order details
+// don't end up in access logs.
+func (c *APIClient) Perform(method, path string, params *Params, res interface{}) (err error) {
+	query, contentType, body := splitParams(method, params)
+	_, err = c.send(method, path, query, contentType, body, res)
 	return
 }
 
-// Get trading calender and allowed trading types for one or more tradable.
-func (c *APIClient) TradableInfo(ids string) (res []TradableInfo, err error) {
-	res = []TradableInfo{}
-	err = c.Perform("GET", fmt.Sprintf("tradables/info/%s", ids), nil, &res)
-	return
+// Sends the JSON encoding of payload as the request body and decodes the JSON response into res.
+func (c *APIClient) PerformJSON(method, path string, payload, res interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = c.send(method, path, nil, "application/json", body, res)
+	return err
 }
 
-// Can be used for populating instrument price graphs for today. Resolution is one minute.
-func (c *APIClient) TradableIntraday(ids string) (res []IntradayGraph, err error) {
-	res = []IntradayGraph{}
-	err = c.Perform("GET", fmt.Sprintf("tradables/intraday/%s", ids), nil, &res)
+// Sends body with the given content type, params are always sent in the query string.
+func (c *APIClient) PerformBody(method, path string, params *Params, contentType string, body []byte, res interface{}) (err error) {
+	_, err = c.send(method, path, params, contentType, body, res)
 	return
 }
 
-// Get all public trades (all trades done on the marketplace) beloning to one ore more tradable.
-func (c *APIClient) TradableTrades(ids string) (res []PublicTrades, err error) {
-	res = []PublicTrades{}
-	err = c.Perform("GET", fmt.Sprintf("tradables/trades/%s", ids), nil, &res)
-	return
+// Decides if the params go in the query string or in a form encoded body
+func splitParams(method string, params *Params) (query *Params, contentType string, body []byte) {
+	if method == "GET" || method == "DELETE" || method == "HEAD" || params == nil {
+		return params, "", nil
+	}
+	return nil, "application/x-www-form-urlencoded", []byte(params.Encode())
 }
 
-func (c *APIClient) Perform(method, path string, params *Params, res interface{}) (err error) {
+func (c *APIClient) send(method, path string, params *Params, contentType string, body []byte, res interface{}) (meta *ResponseMeta, err error) {
 	reqURL, err := c.formatURL(path, params)
 	if err != nil {
 		return
 	}
 
-	req, err := http.NewRequest(method, reqURL.String(), nil)
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, reqURL.String(), reqBody)
 	if err != nil {
 		return
 	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 
+	start := c.now()
 	resp, err := c.perform(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return
 	}
 
+	end := c.now()
+	meta = &ResponseMeta{
+		Method:     method,
+		Path:       path,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+		Latency:    end.Sub(start),
+		RateLimit:  parseRateLimit(resp.Header, end),
+	}
+
+	c.RLock()
+	hook := c.ResponseHook
+	c.RUnlock()
+	if hook != nil {
+		hook(meta)
+	}
+
 	switch resp.StatusCode {
 	case 204:
 		return
 	case 400, 401, 404:
 		errRes := APIError{}
-		if err = json.Unmarshal(body, &errRes); err != nil {
+		if err = json.Unmarshal(respBody, &errRes); err != nil {
 			return
 		}
-		return errRes
+		err = errRes
+		return
 	case 429:
-		return TooManyRequestsError
-	}
-
-	if err = json.Unmarshal(body, res); err != nil {
+		err = TooManyRequestsError
 		return
 	}
 
+	err = json.Unmarshal(respBody, res)
 	return
 }
 
 func (c *APIClient) perform(req *http.Request) (resp *http.Response, err error) {
+	c.RLock()
+	lang, userAgent, session := c.Language, c.UserAgent, c.SessionKey
+	limiter, policy, logger := c.RateLimiter, c.RetryPolicy, c.Logger
+	client := c.Client
+	client.Transport = c.transport()
+	c.RUnlock()
+
+	if lang == "" {
+		lang = NNLANGUAGE
+	}
+
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Accept-Language", "en")
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept-Language", lang)
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if session != "" {
+		req.SetBasicAuth(session, session)
+	}
 
-	c.RLock()
-	if c.SessionKey != "" {
-		req.SetBasicAuth(c.SessionKey, c.SessionKey)
+	for attempt := 1; ; attempt++ {
+		if limiter != nil {
+			limiter.Wait()
+		}
+
+		sent := c.now()
+		resp, err = client.Do(req)
+		received := c.now()
+
+		c.Lock()
+		c.LastUsageAt = received
+		c.Unlock()
+
+		if err == nil {
+			c.observeDateHeader(resp, sent, received)
+		}
+
+		if policy == nil {
+			return
+		}
+		wait, retry := policy.Retry(attempt, req, resp, err)
+		if !retry || (req.Body != nil && req.GetBody == nil) {
+			return
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return
+			}
+		}
+
+		if logger != nil {
+			logger.Printf("nordnet: retrying %s %s in %v (attempt %d)", req.Method, req.URL.Path, wait, attempt)
+		}
+		c.sleep(wait)
+	}
+}
+
+// Returns the transport wrapped in the middleware chain, must be called with the lock held
+func (c *APIClient) transport() http.RoundTripper {
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if c.cassette != nil {
+		rt = c.cassette(rt)
+	}
+
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		rt = c.Middleware[i](rt)
 	}
+
+	return rt
+}
+
+// Returns the current time from the Clock, or the local clock if none is set
+func (c *APIClient) now() time.Time {
+	c.RLock()
+	clock := c.Clock
 	c.RUnlock()
 
-	resp, err = c.Do(req)
+	if clock != nil {
+		return clock()
+	}
+	return time.Now()
+}
 
-	c.Lock()
-	c.LastUsageAt = time.Now()
-	c.Unlock()
+// Sleeps with the Sleeper, or the local clock if none is set
+func (c *APIClient) sleep(d time.Duration) {
+	c.RLock()
+	sleep := c.Sleeper
+	c.RUnlock()
 
-	return
+	if sleep != nil {
+		sleep(d)
+		return
+	}
+	time.Sleep(d)
 }
 
 func (c *APIClient) formatURL(path string, params *Params) (*url.URL, error) {
@@ -1,11 +1,14 @@
 package api
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	. "github.com/denro/nordnet/util/models"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -74,21 +77,21 @@ func TestAccountIntegration(t *testing.T) {
 		assert := assert.New(t)
 
 		assert.Equal("test", resp.AccountCurrency)
-		assert.Equal(Amount{1.1, "test"}, resp.AccountCredit)
-		assert.Equal(Amount{1.1, "test"}, resp.AccountSum)
-		assert.Equal(Amount{1.1, "test"}, resp.Collateral)
-		assert.Equal(Amount{1.1, "test"}, resp.CreditAccountSum)
-		assert.Equal(Amount{1.1, "test"}, resp.ForwardSum)
-		assert.Equal(Amount{1.1, "test"}, resp.FutureSum)
-		assert.Equal(Amount{1.1, "test"}, resp.UnrealizedFutureProfitLoss)
-		assert.Equal(Amount{1.1, "test"}, resp.FullMarketvalue)
-		assert.Equal(Amount{1.1, "test"}, resp.Interest)
-		assert.Equal(Amount{1.1, "test"}, resp.IntradayCredit)
-		assert.Equal(Amount{1.1, "test"}, resp.LoanLimit)
-		assert.Equal(Amount{1.1, "test"}, resp.OwnCapital)
-		assert.Equal(Amount{1.1, "test"}, resp.OwnCapitalMorning)
-		assert.Equal(Amount{1.1, "test"}, resp.PawnValue)
-		assert.Equal(Amount{1.1, "test"}, resp.TradingPower)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.AccountCredit)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.AccountSum)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.Collateral)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.CreditAccountSum)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.ForwardSum)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.FutureSum)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.UnrealizedFutureProfitLoss)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.FullMarketvalue)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.Interest)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.IntradayCredit)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.LoanLimit)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.OwnCapital)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.OwnCapitalMorning)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.PawnValue)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, resp.TradingPower)
 	}
 }
 
@@ -104,19 +107,19 @@ func TestAccountLedgersIntegration(t *testing.T) {
 		assert.NotEmpty(resp)
 
 		accLedger := resp[0]
-		assert.Equal(Amount{1.1, "test"}, accLedger.TotalAccIntDeb)
-		assert.Equal(Amount{1.1, "test"}, accLedger.TotalAccIntCred)
-		assert.Equal(Amount{1.1, "test"}, accLedger.Total)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, accLedger.TotalAccIntDeb)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, accLedger.TotalAccIntCred)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, accLedger.Total)
 
 		assert.NotEmpty(accLedger.Ledgers)
 
 		ledger := accLedger.Ledgers[0]
 		assert.Equal("test", ledger.Currency)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccountSum)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccountSumAcc)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccIntDeb)
-		assert.Equal(Amount{1.1, "test"}, ledger.AccIntCred)
-		assert.Equal(Amount{1.1, "test"}, ledger.ExchangeRate)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, ledger.AccountSum)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, ledger.AccountSumAcc)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, ledger.AccIntDeb)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, ledger.AccIntCred)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, ledger.ExchangeRate)
 	}
 }
 
@@ -134,25 +137,25 @@ func TestAccountOrdersIntegration(t *testing.T) {
 		order := resp[0]
 		assert.EqualValues(123, order.Accno)
 		assert.EqualValues(123, order.OrderId)
-		assert.Equal(Amount{1.1, "test"}, order.Price)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, order.Price)
 		assert.Equal(1.1, order.Volume)
 		assert.Equal(TradableId{"test", 123}, order.Tradable)
 		assert.Equal(1.1, order.OpenVolume)
 		assert.Equal(1.1, order.TradedVolume)
-		assert.Equal("test", order.Side)
+		assert.Equal(Side("test"), order.Side)
 		assert.EqualValues(123, order.Modified)
 		assert.Equal("test", order.Reference)
-		assert.Equal(ActivationCondition{"test", 1.1, 1.1, "test"}, order.ActivationCondition)
-		assert.Equal("test", order.PriceCondition)
-		assert.Equal("test", order.VolumeCondition)
+		assert.Equal(ActivationCondition{"test", MustDecimal("1.1"), MustDecimal("1.1"), "test"}, order.ActivationCondition)
+		assert.Equal(PriceCondition("test"), order.PriceCondition)
+		assert.Equal(VolumeCondition("test"), order.VolumeCondition)
 		assert.Equal(Validity{"test", 123}, order.Validity)
-		assert.Equal("test", order.ActionState)
-		assert.Equal("test", order.OrderState)
+		assert.Equal(ActionState("test"), order.ActionState)
+		assert.Equal(OrderState("test"), order.OrderState)
 	}
 }
 
 func TestCreateOrderIntegration(t *testing.T) {
-	client, ts := setup(t, "POST", "/2/accounts/1000000/orders?currency=SEK&identifier=101&market_id=11&price=65&side=buy&volume=100", defSessionKey, orderJSON)
+	client, ts := setupWithBody(t, "POST", "/2/accounts/1000000/orders", "currency=SEK&identifier=101&market_id=11&price=65&side=buy&volume=100", defSessionKey, orderJSON)
 	defer ts.Close()
 
 	params := &Params{"identifier": "101", "market_id": "11", "price": "65", "volume": "100", "side": "buy", "currency": "SEK"}
@@ -179,7 +182,7 @@ func TestActivateOrderIntegration(t *testing.T) {
 }
 
 func TestUpdateOrderIntegration(t *testing.T) {
-	client, ts := setup(t, "PUT", "/2/accounts/1000000/orders/1000?currency=SEK&price=65&volume=100", defSessionKey, orderJSON)
+	client, ts := setupWithBody(t, "PUT", "/2/accounts/1000000/orders/1000", "currency=SEK&price=65&volume=100", defSessionKey, orderJSON)
 	defer ts.Close()
 
 	params := &Params{"price": "65", "volume": "100", "currency": "SEK"}
@@ -226,11 +229,11 @@ func TestAccountPositionsIntegration(t *testing.T) {
 
 		assert.Equal(1.1, position.Qty)
 		assert.Equal(1.1, position.PawnPercent)
-		assert.Equal(Amount{1.1, "test"}, position.MarketValueAcc)
-		assert.Equal(Amount{1.1, "test"}, position.MarketValue)
-		assert.Equal(Amount{1.1, "test"}, position.AcqPriceAcc)
-		assert.Equal(Amount{1.1, "test"}, position.AcqPrice)
-		assert.Equal(Amount{1.1, "test"}, position.MorningPrice)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, position.MarketValueAcc)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, position.MarketValue)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, position.AcqPriceAcc)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, position.AcqPrice)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, position.MorningPrice)
 	}
 }
 
@@ -251,9 +254,9 @@ func TestAccountTradesIntegration(t *testing.T) {
 		assert.EqualValues(123, trade.OrderId)
 		assert.Equal("test", trade.TradeId)
 		assert.Equal(TradableId{"test", 123}, trade.Tradable)
-		assert.Equal(Amount{1.1, "test"}, trade.Price)
+		assert.Equal(Amount{MustDecimal("1.1"), "test"}, trade.Price)
 		assert.Equal(1.1, trade.Volume)
-		assert.Equal("test", trade.Side)
+		assert.Equal(Side("test"), trade.Side)
 		assert.Equal("test", trade.Counterparty)
 		assert.EqualValues(123, trade.Tradetime)
 	}
@@ -280,7 +283,7 @@ func TestLookupCountriesIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/countries/US,SV", defSessionKey, countriesJSON)
 	defer ts.Close()
 
-	if resp, err := client.LookupCountries("US,SV"); err != nil {
+	if resp, err := client.LookupCountries("US", "SV"); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -313,7 +316,7 @@ func TestLookupIndicatorsIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/indicators/src:identifier,src:identifier", defSessionKey, indicatorsJSON)
 	defer ts.Close()
 
-	if resp, err := client.LookupIndicators("src:identifier,src:identifier"); err != nil {
+	if resp, err := client.LookupIndicators(IndicatorId{"src", "identifier"}, IndicatorId{"src", "identifier"}); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -346,7 +349,7 @@ func TestInstrumentsIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/instruments/1,2", defSessionKey, instrumentsJSON)
 	defer ts.Close()
 
-	if resp, err := client.Instruments("1,2"); err != nil {
+	if resp, err := client.Instruments(1, 2); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -423,7 +426,7 @@ func TestInstrumentOptionPairsIntegration(t *testing.T) {
 		assert.NotEmpty(resp)
 
 		optionPair := resp[0]
-		assert.Equal(1.1, optionPair.StrikePrice)
+		assert.Equal(MustDecimal("1.1"), optionPair.StrikePrice)
 		assert.Equal("test", optionPair.ExpirationDate)
 
 		assertInstrument(assert, &optionPair.Call)
@@ -588,7 +591,7 @@ func TestListIntegration(t *testing.T) {
 }
 
 func TestLoginIntegration(t *testing.T) {
-	client, ts := setup(t, "POST", "/2/login?auth=SECRET&service=TEST", "", loginJSON)
+	client, ts := setupWithBody(t, "POST", "/2/login", "auth=SECRET&service=TEST", "", loginJSON)
 	defer ts.Close()
 
 	client.Credentials = "SECRET"
@@ -673,7 +676,7 @@ func TestMarketIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/markets/123,123", defSessionKey, marketsJSON)
 	defer ts.Close()
 
-	if resp, err := client.Market("123,123"); err != nil {
+	if resp, err := client.Market(123, 123); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -715,7 +718,7 @@ func TestNewsIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/news/123,123", defSessionKey, newsItemJSON)
 	defer ts.Close()
 
-	if resp, err := client.News("123,123"); err != nil {
+	if resp, err := client.News(123, 123); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -787,9 +790,9 @@ func TestTickSizesIntegration(t *testing.T) {
 
 		tickSizeInterval := tickSize.Ticks[0]
 		assert.EqualValues(123, tickSizeInterval.Decimals)
-		assert.Equal(1.1, tickSizeInterval.FromPrice)
-		assert.Equal(1.1, tickSizeInterval.ToPrice)
-		assert.Equal(1.1, tickSizeInterval.Tick)
+		assert.Equal(MustDecimal("1.1"), tickSizeInterval.FromPrice)
+		assert.Equal(MustDecimal("1.1"), tickSizeInterval.ToPrice)
+		assert.Equal(MustDecimal("1.1"), tickSizeInterval.Tick)
 	}
 }
 
@@ -797,7 +800,7 @@ func TestTickSizeIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/tick_sizes/123,123", defSessionKey, tickSizesJSON)
 	defer ts.Close()
 
-	if resp, err := client.TickSize("123,123"); err != nil {
+	if resp, err := client.TickSize(123, 123); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -808,9 +811,9 @@ func TestTickSizeIntegration(t *testing.T) {
 
 		tickSizeInterval := tickSize.Ticks[0]
 		assert.EqualValues(123, tickSizeInterval.Decimals)
-		assert.Equal(1.1, tickSizeInterval.FromPrice)
-		assert.Equal(1.1, tickSizeInterval.ToPrice)
-		assert.Equal(1.1, tickSizeInterval.Tick)
+		assert.Equal(MustDecimal("1.1"), tickSizeInterval.FromPrice)
+		assert.Equal(MustDecimal("1.1"), tickSizeInterval.ToPrice)
+		assert.Equal(MustDecimal("1.1"), tickSizeInterval.Tick)
 	}
 }
 
@@ -818,7 +821,7 @@ func TestTradableInfoIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/tradables/info/11:101,13:101", defSessionKey, tradableInfoJSON)
 	defer ts.Close()
 
-	if resp, err := client.TradableInfo("11:101,13:101"); err != nil {
+	if resp, err := client.TradableInfo(TradableId{"101", 11}, TradableId{"101", 13}); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -843,7 +846,7 @@ func TestTradableIntradayIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/tradables/intraday/11:101,13:101", defSessionKey, tradableIntradayJSON)
 	defer ts.Close()
 
-	if resp, err := client.TradableIntraday("11:101,13:101"); err != nil {
+	if resp, err := client.TradableIntraday(TradableId{"101", 11}, TradableId{"101", 13}); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -857,9 +860,9 @@ func TestTradableIntradayIntegration(t *testing.T) {
 
 		tick := tradableIntraday.Ticks[0]
 		assert.EqualValues(123, tick.Timestamp)
-		assert.Equal(1.1, tick.Last)
-		assert.Equal(1.1, tick.Low)
-		assert.Equal(1.1, tick.High)
+		assert.Equal(MustDecimal("1.1"), tick.Last)
+		assert.Equal(MustDecimal("1.1"), tick.Low)
+		assert.Equal(MustDecimal("1.1"), tick.High)
 		assert.Equal(1.1, tick.Volume)
 		assert.EqualValues(123, tick.NoOfTrades)
 	}
@@ -869,7 +872,7 @@ func TestTradableTradesIntegration(t *testing.T) {
 	client, ts := setup(t, "GET", "/2/tradables/trades/11:101,13:101", defSessionKey, tradableTradesJSON)
 	defer ts.Close()
 
-	if resp, err := client.TradableTrades("11:101,13:101"); err != nil {
+	if resp, err := client.TradableTrades(TradableId{"101", 11}, TradableId{"101", 13}); err != nil {
 		t.Fatal(err)
 	} else {
 		assert := assert.New(t)
@@ -885,7 +888,7 @@ func TestTradableTradesIntegration(t *testing.T) {
 		assert.Equal("test", trade.BrokerBuying)
 		assert.Equal("test", trade.BrokerSelling)
 		assert.EqualValues(123, trade.Volume)
-		assert.Equal(1.1, trade.Price)
+		assert.Equal(MustDecimal("1.1"), trade.Price)
 		assert.Equal("test", trade.TradeId)
 		assert.Equal("test", trade.TradeType)
 		assert.EqualValues(123, trade.TradeTimestamp)
@@ -895,9 +898,9 @@ func TestTradableTradesIntegration(t *testing.T) {
 // Assert Order type
 func assertOrder(assert *assert.Assertions, order *OrderReply) {
 	assert.EqualValues(123, order.OrderId)
-	assert.Equal("test", order.ResultCode)
-	assert.Equal("test", order.OrderState)
-	assert.Equal("test", order.ActionState)
+	assert.Equal(ResultCode("test"), order.ResultCode)
+	assert.Equal(OrderState("test"), order.OrderState)
+	assert.Equal(ActionState("test"), order.ActionState)
 	assert.Equal("test", order.Message)
 }
 
@@ -936,7 +939,7 @@ func assertInstrument(assert *assert.Assertions, instrument *Instrument) {
 	assert.Equal("test", instrument.Symbol)
 	assert.Equal("test", instrument.IsinCode)
 	assert.Equal("test", instrument.MarketView)
-	assert.Equal(1.1, instrument.StrikePrice)
+	assert.Equal(MustDecimal("1.1"), instrument.StrikePrice)
 	assert.Equal(1.1, instrument.NumberOfSecurities)
 	assert.Equal("test", instrument.ProspectusUrl)
 	assert.Equal("test", instrument.ExpirationDate)
@@ -952,12 +955,16 @@ func assertInstrument(assert *assert.Assertions, instrument *Instrument) {
 	assert.Equal("test", underlying.IsinCode)
 }
 
-func setupTestServer(t *testing.T, method, path, session string, stubData []byte) *httptest.Server {
+func setupTestServer(t *testing.T, method, path, body, session string, stubData []byte) *httptest.Server {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody, _ := ioutil.ReadAll(r.Body)
+
 		if r.Method != method {
 			t.Fatal(errors.New(fmt.Sprintln("Method was expected to be:", method, "got:", r.Method)))
 		} else if r.RequestURI != path {
 			t.Fatal(errors.New(fmt.Sprintln("Path was expected to be:", path, "got:", r.RequestURI)))
+		} else if string(reqBody) != body {
+			t.Fatal(errors.New(fmt.Sprintln("Body was expected to be:", body, "got:", string(reqBody))))
 		} else if auth := r.Header.Get("Authorization"); auth != "" {
 			if decoded, err := base64.StdEncoding.DecodeString(auth[6:]); err != nil {
 				t.Fatal(err)
@@ -975,7 +982,84 @@ func setupTestServer(t *testing.T, method, path, session string, stubData []byte
 }
 
 func setup(t *testing.T, method, path, session, stubData string) (*APIClient, *httptest.Server) {
-	testServer := setupTestServer(t, method, path, session, []byte(stubData))
+	return setupWithBody(t, method, path, "", session, stubData)
+}
+
+func setupWithBody(t *testing.T, method, path, body, session, stubData string) (*APIClient, *httptest.Server) {
+	testServer := setupTestServer(t, method, path, body, session, []byte(stubData))
 	client := &APIClient{URL: testServer.URL, Service: NNSERVICE, Version: NNAPIVERSION, SessionKey: session}
 	return client, testServer
 }
+
+type staticProvider string
+
+func (p staticProvider) Credentials() (string, error) {
+	return string(p), nil
+}
+
+func TestLoginWithProviderIntegration(t *testing.T) {
+	client, ts := setupWithBody(t, "POST", "/2/login", "auth=FRESH&service=NEXTAPI", "", loginJSON)
+	defer ts.Close()
+
+	client.Credentials = "STALE"
+	client.Provider = staticProvider("FRESH")
+
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "FRESH", client.Credentials)
+}
+
+func TestKeyLoginIntegration(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2/login/start":
+			assert.Equal(t, "KEY", r.FormValue("api_key"))
+			w.Write([]byte(`{"challenge":"CHALLENGE"}`))
+		case "/2/login/verify":
+			sig, _ := base64.StdEncoding.DecodeString(r.FormValue("signature"))
+			if !ed25519.Verify(priv.Public().(ed25519.PublicKey), []byte("CHALLENGE"), sig) {
+				w.WriteHeader(401)
+				w.Write([]byte(`{"code":"NEXT_INVALID_SIGNATURE","message":"Invalid signature"}`))
+				return
+			}
+			w.Write([]byte(loginJSON))
+		default:
+			t.Fatal("Unexpected path:", r.URL.Path)
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION, APIKey: "KEY", PrivateKey: priv}
+
+	if resp, err := client.Login(); err != nil {
+		t.Fatal(err)
+	} else {
+		assert.Equal(t, "test", resp.SessionKey)
+		assert.Equal(t, "test", resp.PublicFeed.Hostname)
+		assert.Equal(t, "test", client.SessionKey)
+	}
+}
+
+func TestPerformJSONIntegration(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "/2/test", r.RequestURI)
+		assert.Equal(t, `{"volume":100}`, string(body))
+		w.Write([]byte(`{"ok":true}`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION}
+
+	res := map[string]bool{}
+	if err := client.PerformJSON("POST", "test", map[string]int{"volume": 100}, &res); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, res["ok"])
+}
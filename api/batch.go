@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/denro/nordnet/util/models"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Max number of ids sent in one request by the batch lookups
+	DefaultBatchSize = 50
+
+	// Max number of batch requests in flight at the same time
+	DefaultBatchParallelism = 4
+
+	// Max length of the joined ids in one request, keeps the URL well under common server limits
+	maxBatchIdsLength = 1500
+)
+
+// Sets how many ids the batch lookups (Instruments, Market, TradableInfo etc.) send per request, and how many requests run concurrently.
+func WithBatching(size, parallelism int) Option {
+	return func(c *APIClient) error {
+		if size < 1 || parallelism < 1 {
+			return errors.New("WithBatching: size and parallelism must be positive")
+		}
+		c.BatchSize = size
+		c.BatchParallelism = parallelism
+		return nil
+	}
+}
+
+// Get one or more instruments, the instrument id is used as key.
+func (c *APIClient) Instruments(ids ...int64) ([]Instrument, error) {
+	return batchLookup[int64, Instrument](c, "instruments", ids, formatInt)
+}
+
+// Lookup one or more countries by country code.
+func (c *APIClient) LookupCountries(countries ...string) ([]Country, error) {
+	return batchLookup[string, Country](c, "countries", countries, formatString)
+}
+
+// Returns info of one or more indicators.
+func (c *APIClient) LookupIndicators(indicators ...IndicatorId) ([]Indicator, error) {
+	return batchLookup[IndicatorId, Indicator](c, "indicators", indicators, IndicatorId.String)
+}
+
+// Lookup one or more markets by market_id. Market 80 is the smart order market. Instruments that can be traded on 2 or more markets gets a tradable on the smart order market. Orders entered with the smart order tradable get smart order routed with the current Nordnet best execution policy.
+func (c *APIClient) Market(ids ...int64) ([]Market, error) {
+	return batchLookup[int64, Market](c, "markets", ids, formatInt)
+}
+
+// Show one or more news items.
+func (c *APIClient) News(ids ...int64) ([]NewsItem, error) {
+	return batchLookup[int64, NewsItem](c, "news", ids, formatInt)
+}
+
+// Get one or more ticksize tables.
+func (c *APIClient) TickSize(ids ...int64) ([]TicksizeTable, error) {
+	return batchLookup[int64, TicksizeTable](c, "tick_sizes", ids, formatInt)
+}
+
+// Get trading calender and allowed trading types for one or more tradable.
+func (c *APIClient) TradableInfo(ids ...TradableId) ([]TradableInfo, error) {
+	return batchLookup[TradableId, TradableInfo](c, "tradables/info", ids, TradableId.URLParam)
+}
+
+// Can be used for populating instrument price graphs for today. Resolution is one minute.
+func (c *APIClient) TradableIntraday(ids ...TradableId) ([]IntradayGraph, error) {
+	return batchLookup[TradableId, IntradayGraph](c, "tradables/intraday", ids, TradableId.URLParam)
+}
+
+// Get all public trades (all trades done on the marketplace) beloning to one ore more tradable.
+func (c *APIClient) TradableTrades(ids ...TradableId) ([]PublicTrades, error) {
+	return batchLookup[TradableId, PublicTrades](c, "tradables/trades", ids, TradableId.URLParam)
+}
+
+// Splits the ids into chunks, fetches path/id1,id2,... for every chunk with bounded parallelism
+// and concatenates the results in the order of the chunks.
+func batchLookup[K any, T any](c *APIClient, path string, ids []K, format func(K) string) ([]T, error) {
+	res := []T{}
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	c.RLock()
+	size, parallelism := c.BatchSize, c.BatchParallelism
+	c.RUnlock()
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	if parallelism < 1 {
+		parallelism = DefaultBatchParallelism
+	}
+
+	chunks := chunkIds(ids, format, size, maxBatchIdsLength)
+	results := make([][]T, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, chunk string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], _, errs[i] = Do[[]T](c, "GET", fmt.Sprintf("%s/%s", path, chunk), nil)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for i := range chunks {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		res = append(res, results[i]...)
+	}
+
+	return res, nil
+}
+
+// Joins the ids with commas, starting a new chunk when it would get more than size ids or maxLength characters
+func chunkIds[K any](ids []K, format func(K) string, size, maxLength int) (chunks []string) {
+	var (
+		current []string
+		length  int
+	)
+
+	for _, id := range ids {
+		s := format(id)
+		if len(current) > 0 && (len(current) >= size || length+1+len(s) > maxLength) {
+			chunks = append(chunks, strings.Join(current, ","))
+			current, length = nil, 0
+		}
+		if len(current) > 0 {
+			length++
+		}
+		current = append(current, s)
+		length += len(s)
+	}
+
+	return append(chunks, strings.Join(current, ","))
+}
+
+func formatInt(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func formatString(s string) string {
+	return s
+}
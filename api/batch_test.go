@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChunkIds(t *testing.T) {
+	ids := []int64{1, 2, 3, 4, 5}
+
+	assert.Equal(t, []string{"1,2", "3,4", "5"}, chunkIds(ids, formatInt, 2, 100))
+	assert.Equal(t, []string{"1,2,3", "4,5"}, chunkIds(ids, formatInt, 10, 5))
+	assert.Equal(t, []string{"1,2,3,4,5"}, chunkIds(ids, formatInt, 10, 100))
+}
+
+func TestBatchLookupOrder(t *testing.T) {
+	var (
+		paths []string
+		mu    sync.Mutex
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		// Answer the first chunk last to make sure results are merged in input order
+		ids := strings.Split(strings.TrimPrefix(r.URL.Path, "/2/instruments/"), ",")
+		if ids[0] == "1" {
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		parts := []string{}
+		for _, id := range ids {
+			parts = append(parts, fmt.Sprintf(`{"instrument_id":%s}`, id))
+		}
+		w.Write([]byte("[" + strings.Join(parts, ",") + "]"))
+	}))
+	defer ts.Close()
+
+	client, _ := NewAPIClientWithOptions("", WithBaseURL(ts.URL), WithBatching(2, 3))
+
+	res, err := client.Instruments(1, 2, 3, 4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []int64{}
+	for _, instrument := range res {
+		ids = append(ids, instrument.InstrumentId)
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+	assert.ElementsMatch(t, []string{"/2/instruments/1,2", "/2/instruments/3,4", "/2/instruments/5"}, paths)
+}
+
+func TestBatchLookupError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/3") {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code":"NOT_FOUND","message":"Not found"}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	client, _ := NewAPIClientWithOptions("", WithBaseURL(ts.URL), WithBatching(1, 2))
+
+	_, err := client.Market(1, 2, 3)
+	assert.EqualError(t, err, "NOT_FOUND: Not found")
+}
+
+func TestBatchLookupEmpty(t *testing.T) {
+	client := &APIClient{URL: "http://invalid.invalid"}
+
+	res, err := client.TradableInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, []TradableInfo{}, res)
+}
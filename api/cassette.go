@@ -0,0 +1,242 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CassetteMode decides if a Cassette records real responses or replays them from disk
+type CassetteMode int
+
+const (
+	Replay CassetteMode = iota
+	Record
+)
+
+// Response headers that are never written to a cassette, Date is dropped so replays don't skew the clock
+var scrubbedHeaders = []string{"Set-Cookie", "Authorization", "Date"}
+
+// Error returned in replay mode when no recorded interaction matches the request
+type CassetteMismatchError struct {
+	Method, Path, Query string
+}
+
+// CassetteMismatchError implements the error interface
+func (e CassetteMismatchError) Error() string {
+	return fmt.Sprintf("cassette: no recorded interaction for %s %s?%s", e.Method, e.Path, e.Query)
+}
+
+// A recorded request and its response
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+	Body   string `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// Cassette records the responses of an APIClient to a file, or serves them back from it, which
+// allows tests to run against real responses without a network connection or credentials.
+// Credentials, signatures and session keys are scrubbed before anything is written to disk.
+//
+// Requests are matched on method, path and normalized query (and form body). In replay mode every
+// interaction is served once in recorded order, and unmatched requests fail with CassetteMismatchError.
+type Cassette struct {
+	Path string
+	Mode CassetteMode
+
+	interactions []*Interaction
+	used         []bool
+
+	sync.Mutex
+}
+
+// Opens the cassette at path. In replay mode the file must exist, in record mode it is created when saving.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{Path: path, Mode: mode}
+	if mode == Record {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, err
+	}
+	c.used = make([]bool, len(c.interactions))
+
+	return c, nil
+}
+
+// Adds the cassette as the innermost middleware of the client, it stays innermost no matter the order of the options.
+func WithCassette(cassette *Cassette) Option {
+	return func(c *APIClient) error {
+		if cassette == nil {
+			return errors.New("WithCassette: cassette is nil")
+		}
+		c.cassette = cassette.Middleware()
+		return nil
+	}
+}
+
+// Returns the middleware recording or replaying requests, it should be the innermost one.
+func (c *Cassette) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			recReq, err := newCassetteRequest(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if c.Mode == Replay {
+				return c.replay(req, recReq)
+			}
+			return c.record(next, req, recReq)
+		})
+	}
+}
+
+// Writes the recorded interactions to Path.
+func (c *Cassette) Save() error {
+	c.Lock()
+	defer c.Unlock()
+
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.Path, data, os.FileMode(0644))
+}
+
+// Returns the recorded interactions that have not been replayed, useful for asserting that a test made every expected request.
+func (c *Cassette) Unused() (res []*Interaction) {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, used := range c.used {
+		if !used {
+			res = append(res, c.interactions[i])
+		}
+	}
+	return
+}
+
+func (c *Cassette) replay(req *http.Request, recReq CassetteRequest) (*http.Response, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, in := range c.interactions {
+		if c.used[i] || in.Request != recReq {
+			continue
+		}
+		c.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, CassetteMismatchError{recReq.Method, recReq.Path, recReq.Query}
+}
+
+func (c *Cassette) record(next http.RoundTripper, req *http.Request, recReq CassetteRequest) (*http.Response, error) {
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return resp, err
+	}
+
+	header := resp.Header.Clone()
+	for _, key := range scrubbedHeaders {
+		header.Del(key)
+	}
+
+	c.Lock()
+	c.interactions = append(c.interactions, &Interaction{
+		Request:  recReq,
+		Response: CassetteResponse{resp.StatusCode, header, RedactBody(raw)},
+	})
+	c.used = append(c.used, true)
+	c.Unlock()
+
+	return resp, nil
+}
+
+// Builds the matching key of the request with sensitive values scrubbed
+func newCassetteRequest(req *http.Request) (CassetteRequest, error) {
+	recReq := CassetteRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  normalizeValues(req.URL.Query()),
+	}
+
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return recReq, err
+		}
+		raw, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return recReq, err
+		}
+
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			if values, err := url.ParseQuery(string(raw)); err == nil {
+				recReq.Body = normalizeValues(values)
+			}
+		} else {
+			recReq.Body = RedactBody(raw)
+		}
+	}
+
+	return recReq, nil
+}
+
+// Encodes the values with sorted keys and sensitive values replaced
+func normalizeValues(values url.Values) string {
+	for _, field := range redactedFields {
+		if _, ok := values[field]; ok {
+			values.Set(field, "REDACTED")
+		}
+	}
+	for _, vs := range values {
+		sort.Strings(vs)
+	}
+	return values.Encode()
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2/login":
+			w.Write([]byte(loginJSON))
+		case "/2/accounts":
+			w.Write([]byte(accountsJSON))
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"code":"NOT_FOUND","message":"Not found"}`))
+		}
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := NewCassette(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ := NewAPIClientWithOptions("SECRETCRED", WithBaseURL(ts.URL), WithCassette(recorder))
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Accounts(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Market(11)
+	assert.EqualError(t, err, "NOT_FOUND: Not found")
+
+	ts.Close()
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	assert.NotContains(t, string(data), "SECRETCRED")
+	assert.Contains(t, string(data), `session_key\":\"REDACTED`)
+
+	player, err := NewCassette(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, _ = NewAPIClientWithOptions("OTHERCRED", WithBaseURL(ts.URL), WithCassette(player))
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if accounts, err := client.Accounts(); err != nil {
+		t.Fatal(err)
+	} else {
+		assert.EqualValues(t, 123, accounts[0].Accno)
+	}
+	_, err = client.Market(11)
+	assert.EqualError(t, err, "NOT_FOUND: Not found")
+	assert.Empty(t, player.Unused())
+
+	_, err = client.Accounts()
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "cassette: no recorded interaction for GET /2/accounts"))
+	}
+}
+
+func TestCassetteStaysInnermost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"request":{"method":"GET","path":"/next/2/accounts"},"response":{"status_code":200,"body":"[]"}}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := NewCassette(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := 0
+	client, _ := NewAPIClientWithOptions("", WithCassette(player), WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			seen++
+			return next.RoundTrip(req)
+		})
+	}))
+
+	if _, err := client.Accounts(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, seen)
+}
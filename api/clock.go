@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"github.com/denro/nordnet/util"
+	"net/http"
+	"time"
+)
+
+const (
+	// Error code returned by Login when the timestamp in the credentials is too far from the server time
+	InvalidTimestampCode = "NEXT_LOGIN_INVALID_TIMESTAMP"
+
+	// The Date header only has second resolution
+	dateHeaderResolution = time.Second
+)
+
+var (
+	SkewCompensationError = errors.New("Clock skew compensation requires a util.TimedCredentialProvider")
+)
+
+// ClockSkew returns how far the server clock is ahead of the local clock, and whether it has been measured yet.
+func (c *APIClient) ClockSkew() (time.Duration, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.skew, c.skewMeasured
+}
+
+// ServerTime returns the local time corrected with the measured clock skew.
+func (c *APIClient) ServerTime() time.Time {
+	skew, _ := c.ClockSkew()
+	return c.now().Add(skew)
+}
+
+// MeasureClockSkew calls SystemStatus and measures the skew from its millisecond timestamp.
+func (c *APIClient) MeasureClockSkew() (skew time.Duration, err error) {
+	sent := c.now()
+	status, err := c.SystemStatus()
+	if err != nil {
+		return
+	}
+	received := c.now()
+
+	if status.Timestamp == 0 {
+		err = errors.New("SystemStatus did not contain a timestamp")
+		return
+	}
+
+	c.observeServerTime(status.Timestamp.Time(), sent, received, 0)
+	skew, _ = c.ClockSkew()
+	return
+}
+
+// Updates the skew estimate from the Date header of a response
+func (c *APIClient) observeDateHeader(resp *http.Response, sent, received time.Time) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	// The header is truncated to whole seconds, assume the middle of that second
+	c.observeServerTime(date.Add(dateHeaderResolution/2), sent, received, dateHeaderResolution)
+}
+
+// Compares the server time with the midpoint of the request. Estimates with a coarse resolution
+// only replace the current one if they disagree by more than that resolution.
+func (c *APIClient) observeServerTime(server, sent, received time.Time, resolution time.Duration) {
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := server.Sub(local)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.skewMeasured && resolution > 0 {
+		if diff := skew - c.skew; diff <= resolution && diff >= -resolution {
+			return
+		}
+	}
+
+	c.skew = skew
+	c.skewMeasured = true
+}
+
+// Returns fresh credentials from the provider, stamped with the server time when compensating for skew
+func (c *APIClient) refreshCredentials(provider util.CredentialProvider) (err error) {
+	c.RLock()
+	compensate := c.CompensateSkew
+	c.RUnlock()
+
+	var cred string
+	if compensate {
+		timed, ok := provider.(util.TimedCredentialProvider)
+		if !ok {
+			return SkewCompensationError
+		}
+		if _, measured := c.ClockSkew(); !measured {
+			if _, err = c.MeasureClockSkew(); err != nil {
+				return
+			}
+		}
+		cred, err = timed.CredentialsAt(c.ServerTime())
+	} else {
+		cred, err = provider.Credentials()
+	}
+	if err != nil {
+		return
+	}
+
+	c.Lock()
+	c.Credentials = cred
+	c.Unlock()
+
+	return
+}
+
+// Reports if the error is the server rejecting the credentials timestamp
+func isInvalidTimestamp(err error) bool {
+	apiErr, ok := err.(APIError)
+	return ok && apiErr.Code == InvalidTimestampCode
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Provider recording the time it was asked to stamp
+type timedProvider struct {
+	stamps []time.Time
+}
+
+func (p *timedProvider) Credentials() (string, error) {
+	return p.CredentialsAt(time.Now())
+}
+
+func (p *timedProvider) CredentialsAt(now time.Time) (string, error) {
+	p.stamps = append(p.stamps, now)
+	return "SECRET", nil
+}
+
+// Server whose clock is offset from the local one
+func skewedServer(offset time.Duration, handler func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().Add(offset)
+		if r.URL.Path == "/2" {
+			fmt.Fprintf(w, `{"timestamp":%d,"system_running":true}`, now.UnixNano()/int64(time.Millisecond))
+			return
+		}
+		w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+		handler(w, r)
+	}))
+}
+
+func TestMeasureClockSkew(t *testing.T) {
+	ts := skewedServer(time.Hour, nil)
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION}
+
+	_, measured := client.ClockSkew()
+	assert.False(t, measured)
+
+	skew, err := client.MeasureClockSkew()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.InDelta(t, float64(time.Hour), float64(skew), float64(time.Second))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), client.ServerTime(), time.Second)
+}
+
+func TestDateHeaderSkew(t *testing.T) {
+	ts := skewedServer(-10*time.Minute, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION}
+	if _, err := client.Accounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	skew, measured := client.ClockSkew()
+	assert.True(t, measured)
+	assert.InDelta(t, float64(-10*time.Minute), float64(skew), float64(2*time.Second))
+}
+
+func TestLoginCompensateSkew(t *testing.T) {
+	ts := skewedServer(time.Hour, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(loginJSON))
+	})
+	defer ts.Close()
+
+	provider := &timedProvider{}
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION, Provider: provider, CompensateSkew: true}
+
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, provider.stamps, 1)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), provider.stamps[0], time.Second)
+}
+
+func TestLoginRetriesInvalidTimestamp(t *testing.T) {
+	attempts := 0
+	ts := skewedServer(0, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"code":"NEXT_LOGIN_INVALID_TIMESTAMP","message":"Invalid timestamp"}`))
+			return
+		}
+		w.Write([]byte(loginJSON))
+	})
+	defer ts.Close()
+
+	provider := &timedProvider{}
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION, Provider: provider, CompensateSkew: true}
+
+	if _, err := client.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, attempts)
+	assert.Len(t, provider.stamps, 2)
+	assert.Equal(t, "test", client.SessionKey)
+}
+
+func TestLoginCompensateSkewRequiresTimedProvider(t *testing.T) {
+	client := &APIClient{Provider: staticProvider("SECRET"), CompensateSkew: true}
+
+	_, err := client.Login()
+	assert.Equal(t, SkewCompensationError, err)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResponseMeta describes the HTTP response behind a decoded result
+type ResponseMeta struct {
+	// Method and path of the request, relative to the API version like the path given to Do
+	Method, Path string
+
+	StatusCode int
+	Header     http.Header
+
+	// The raw response body, before JSON decoding
+	Body []byte
+
+	// Time from sending the request until the whole body was read, including retries
+	Latency time.Duration
+
+	RateLimit RateLimitHint
+}
+
+// Rate limit information sent by the server, fields are zero when the headers are missing.
+// Nordnet does not document any rate limit headers, the X-RateLimit-Limit, X-RateLimit-Remaining
+// and X-RateLimit-Reset names are assumed from common practice. Retry-After is standard HTTP.
+type RateLimitHint struct {
+	Limit, Remaining int
+
+	// Time until the limit resets, and how long to wait before retrying after a 429
+	Reset, RetryAfter time.Duration
+}
+
+// Do sends a request like Perform and decodes the response into a T. Every endpoint method is a thin
+// wrapper around Do, callers that need the status code, headers or raw body can call it directly:
+//
+//	accounts, meta, err := api.Do[[]models.Account](client, "GET", "accounts", nil)
+//
+// The meta is returned whenever a response was received, also together with APIError. To get the
+// meta of the typed endpoint methods, set a hook with WithResponseHook.
+func Do[T any](c *APIClient, method, path string, params *Params) (res T, meta *ResponseMeta, err error) {
+	query, contentType, body := splitParams(method, params)
+	meta, err = c.send(method, path, query, contentType, body, &res)
+	return
+}
+
+// Same as Do but sends the JSON encoding of payload as the body.
+func DoJSON[T any](c *APIClient, method, path string, payload interface{}) (res T, meta *ResponseMeta, err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	meta, err = c.send(method, path, nil, "application/json", body, &res)
+	return
+}
+
+// Reads the rate limit headers of the response
+func parseRateLimit(header http.Header, now time.Time) (hint RateLimitHint) {
+	hint.Limit, _ = strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	hint.Remaining, _ = strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		hint.Reset = time.Duration(reset) * time.Second
+	}
+
+	if retry := header.Get("Retry-After"); retry != "" {
+		if secs, err := strconv.Atoi(retry); err == nil {
+			hint.RetryAfter = time.Duration(secs) * time.Second
+		} else if date, err := http.ParseTime(retry); err == nil {
+			hint.RetryAfter = date.Sub(now)
+		}
+	}
+
+	return
+}
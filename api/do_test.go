@@ -0,0 +1,72 @@
+package api
+
+import (
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoMeta(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "20")
+		w.Header().Set("X-RateLimit-Remaining", "19")
+		w.Header().Set("X-RateLimit-Reset", "10")
+		w.Write([]byte(accountsJSON))
+	}))
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION}
+
+	accounts, meta, err := Do[[]Account](client, "GET", "accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.EqualValues(t, 123, accounts[0].Accno)
+	assert.Equal(t, 200, meta.StatusCode)
+	assert.Equal(t, accountsJSON, string(meta.Body))
+	assert.Equal(t, RateLimitHint{Limit: 20, Remaining: 19, Reset: 10 * time.Second}, meta.RateLimit)
+	assert.True(t, meta.Latency > 0)
+}
+
+func TestDoMetaOnError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(429)
+	}))
+	defer ts.Close()
+
+	client := &APIClient{URL: ts.URL, Version: NNAPIVERSION}
+
+	_, meta, err := Do[[]Account](client, "GET", "accounts", nil)
+	assert.Equal(t, TooManyRequestsError, err)
+	assert.Equal(t, 429, meta.StatusCode)
+	assert.Equal(t, 5*time.Second, meta.RateLimit.RetryAfter)
+}
+
+func TestResponseHook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "7")
+		w.Write([]byte(accountsJSON))
+	}))
+	defer ts.Close()
+
+	var metas []*ResponseMeta
+	client, _ := NewAPIClientWithOptions("", WithBaseURL(ts.URL), WithResponseHook(func(meta *ResponseMeta) {
+		metas = append(metas, meta)
+	}))
+
+	if _, err := client.Accounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, metas, 1) {
+		assert.Equal(t, "GET", metas[0].Method)
+		assert.Equal(t, "accounts", metas[0].Path)
+		assert.Equal(t, 200, metas[0].StatusCode)
+		assert.Equal(t, 7, metas[0].RateLimit.Remaining)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Environment groups the settings that differ between the Nordnet test system and the production sites.
+type Environment struct {
+	Name     string
+	URL      string
+	Service  string
+	Version  string
+	Language string
+
+	// Name of the public key file Nordnet distributes for encrypting the credentials in this environment
+	PemFile string
+}
+
+// The available environments, production is split per country site
+var (
+	TestEnvironment = Environment{
+		Name:     "test",
+		URL:      `https://api.test.nordnet.se/next`,
+		Service:  NNSERVICE,
+		Version:  NNAPIVERSION,
+		Language: "en",
+		PemFile:  "NEXTAPI_TEST_public.pem",
+	}
+
+	ProductionSE = Environment{
+		Name:     "production-se",
+		URL:      NNBASEURL,
+		Service:  NNSERVICE,
+		Version:  NNAPIVERSION,
+		Language: "sv",
+		PemFile:  "NEXTAPI_PROD_public.pem",
+	}
+
+	ProductionNO = Environment{
+		Name:     "production-no",
+		URL:      `https://www.nordnet.no/next`,
+		Service:  NNSERVICE,
+		Version:  NNAPIVERSION,
+		Language: "no",
+		PemFile:  "NEXTAPI_PROD_public.pem",
+	}
+
+	ProductionDK = Environment{
+		Name:     "production-dk",
+		URL:      `https://www.nordnet.dk/next`,
+		Service:  NNSERVICE,
+		Version:  NNAPIVERSION,
+		Language: "da",
+		PemFile:  "NEXTAPI_PROD_public.pem",
+	}
+
+	ProductionFI = Environment{
+		Name:     "production-fi",
+		URL:      `https://www.nordnet.fi/next`,
+		Service:  NNSERVICE,
+		Version:  NNAPIVERSION,
+		Language: "fi",
+		PemFile:  "NEXTAPI_PROD_public.pem",
+	}
+
+	Environments = map[string]Environment{
+		TestEnvironment.Name: TestEnvironment,
+		ProductionSE.Name:    ProductionSE,
+		ProductionNO.Name:    ProductionNO,
+		ProductionDK.Name:    ProductionDK,
+		ProductionFI.Name:    ProductionFI,
+	}
+)
+
+// Returns the environment with the given name, e.g. "test" or "production-se".
+func LookupEnvironment(name string) (Environment, error) {
+	if env, ok := Environments[name]; ok {
+		return env, nil
+	}
+	return Environment{}, fmt.Errorf("Unknown environment: %s", name)
+}
+
+// Reads the public key of the environment from dir, to be used with util.GenerateCredentials.
+func (e Environment) ReadPem(dir string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(dir, e.PemFile))
+}
+
+// Constructor function creating a client for the given environment.
+func NewAPIClientForEnvironment(env Environment, credentials string) *APIClient {
+	client := NewAPIClient(credentials)
+	client.SetEnvironment(env)
+	return client
+}
+
+// Switches the client to another environment. The session is cleared since it is not valid in the new environment.
+func (c *APIClient) SetEnvironment(env Environment) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Environment = env.Name
+	c.URL = env.URL
+	c.Service = env.Service
+	c.Version = env.Version
+	c.Language = env.Language
+	c.SessionKey = ""
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupEnvironment(t *testing.T) {
+	env, err := LookupEnvironment("production-no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ProductionNO, env)
+
+	_, err = LookupEnvironment("nowhere")
+	assert.EqualError(t, err, "Unknown environment: nowhere")
+}
+
+func TestNewAPIClientForEnvironment(t *testing.T) {
+	client := NewAPIClientForEnvironment(TestEnvironment, "SECRET")
+
+	assert.Equal(t, "test", client.Environment)
+	assert.Equal(t, "https://api.test.nordnet.se/next", client.URL)
+	assert.Equal(t, NNSERVICE, client.Service)
+	assert.Equal(t, NNAPIVERSION, client.Version)
+	assert.Equal(t, "en", client.Language)
+	assert.Equal(t, "SECRET", client.Credentials)
+}
+
+func TestEnvironmentLanguage(t *testing.T) {
+	var lang string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang = r.Header.Get("Accept-Language")
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	env := ProductionFI
+	env.URL = ts.URL
+
+	client := NewAPIClientForEnvironment(env, "")
+	if _, err := client.Markets(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "fi", lang)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"github.com/denro/nordnet/util"
+	. "github.com/denro/nordnet/util/models"
+)
+
+// KeyLogin authenticates with a registered public key instead of a password. A challenge is requested
+// for the APIKey, signed with PrivateKey and exchanged for a session. The session key is stored on the
+// client and the returned Login holds the feed addresses, just like Login.
+func (c *APIClient) KeyLogin() (res *Login, err error) {
+	c.RLock()
+	apiKey, key, service := c.APIKey, c.PrivateKey, c.Service
+	c.RUnlock()
+
+	if apiKey == "" || key == nil {
+		return nil, errors.New("KeyLogin requires APIKey and PrivateKey")
+	}
+
+	challenge := &LoginChallenge{}
+	if err = c.Perform("POST", "login/start", &Params{"api_key": apiKey}, challenge); err != nil {
+		return
+	}
+
+	signature, err := util.SignChallenge(key, challenge.Challenge)
+	if err != nil {
+		return
+	}
+
+	res = &Login{}
+	params := &Params{"api_key": apiKey, "service": service, "signature": signature}
+	if err = c.Perform("POST", "login/verify", params, res); err != nil {
+		return
+	}
+
+	c.Lock()
+	c.SessionKey = res.SessionKey
+	c.Unlock()
+
+	return
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header carrying the id set by RequestIDMiddleware
+const RequestIDHeader = "X-Request-Id"
+
+// Query, form and JSON fields whose values are never logged
+var redactedFields = []string{"auth", "session_key", "signature", "api_key"}
+
+var redactedJSON = regexp.MustCompile(`"(` + strings.Join(redactedFields, "|") + `)"\s*:\s*"[^"]*"`)
+
+// Middleware wraps the http.RoundTripper that sends the requests of the client, which makes it possible
+// to hook in logging, metrics, tracing, request signing or fault injection. A middleware gets the next
+// RoundTripper in the chain and returns a new one, which usually does something before and/or after
+// calling next:
+//
+//	func Header(key, value string) api.Middleware {
+//		return func(next http.RoundTripper) http.RoundTripper {
+//			return api.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+//				req.Header.Set(key, value)
+//				return next.RoundTrip(req)
+//			})
+//		}
+//	}
+//
+// Middleware is added with WithMiddleware when constructing the client, or with Use afterwards.
+// The first middleware added is the outermost, so it sees the request first and the response last.
+// The client sets the Accept, Content-Type and Authorization headers before the chain is called.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc lets an ordinary function be used as a http.RoundTripper
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTripperFunc implements the http.RoundTripper interface
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Appends middleware to the chain, it applies to requests sent after the call.
+func (c *APIClient) Use(middleware ...Middleware) {
+	c.Lock()
+	defer c.Unlock()
+	c.Middleware = append(c.Middleware, middleware...)
+}
+
+// Sets a random id in the X-Request-Id header unless the request already has one, so that
+// log lines and server side support requests can be correlated. The id is set on a clone, as
+// a http.RoundTripper must not modify the request, so every retry gets an id of its own.
+func RequestIDMiddleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(RequestIDHeader, newRequestID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Calls observe with the request, the response status (0 on transport errors) and how long the round trip took.
+func TimingMiddleware(observe func(req *http.Request, status int, latency time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			observe(req, status, time.Since(start))
+
+			return resp, err
+		})
+	}
+}
+
+// Logs every request and response as key=value pairs. Credentials, signatures and session keys are redacted
+// from URLs and bodies, and the Authorization header is never logged. Bodies are only logged when logBodies is set.
+func LoggingMiddleware(logger Logger, logBodies bool) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			id := req.Header.Get(RequestIDHeader)
+
+			fields := []string{"method=" + req.Method, "url=" + strconv.Quote(RedactURL(req.URL))}
+			if id != "" {
+				fields = append(fields, "request_id="+id)
+			}
+			if logBodies && req.Body != nil && req.GetBody != nil {
+				if body, err := req.GetBody(); err == nil {
+					raw, _ := ioutil.ReadAll(body)
+					body.Close()
+					fields = append(fields, "body="+strconv.Quote(RedactBody(raw)))
+				}
+			}
+			logger.Printf("nordnet: request %s", strings.Join(fields, " "))
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			fields = []string{"method=" + req.Method, "path=" + strconv.Quote(req.URL.Path), "duration=" + time.Since(start).String()}
+			if id != "" {
+				fields = append(fields, "request_id="+id)
+			}
+
+			if err != nil {
+				fields = append(fields, "error="+strconv.Quote(err.Error()))
+				logger.Printf("nordnet: response %s", strings.Join(fields, " "))
+				return resp, err
+			}
+
+			fields = append(fields, fmt.Sprintf("status=%d", resp.StatusCode))
+			if logBodies {
+				raw, readErr := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+				if readErr != nil {
+					return resp, readErr
+				}
+				fields = append(fields, "body="+strconv.Quote(RedactBody(raw)))
+			}
+			logger.Printf("nordnet: response %s", strings.Join(fields, " "))
+
+			return resp, err
+		})
+	}
+}
+
+// Returns the URL with the values of sensitive query parameters replaced.
+func RedactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+
+	query := redacted.Query()
+	changed := false
+	for _, field := range redactedFields {
+		if _, ok := query[field]; ok {
+			query.Set(field, "REDACTED")
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+
+	return redacted.String()
+}
+
+// Returns the body with the values of sensitive JSON or form fields replaced.
+func RedactBody(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return redactedJSON.ReplaceAllString(string(body), `"$1":"REDACTED"`)
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return string(body)
+	}
+
+	changed := false
+	for _, field := range redactedFields {
+		if _, ok := values[field]; ok {
+			values.Set(field, "REDACTED")
+			changed = true
+		}
+	}
+	if !changed {
+		return string(body)
+	}
+	return values.Encode()
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/denro/nordnet/util"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Timeout used by NewAPIClientWithOptions unless another one is given
+	DefaultTimeout = 30 * time.Second
+)
+
+// Logger is satisfied by *log.Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Clock returns the current time, replaceable in tests
+type Clock func() time.Time
+
+// Sleeper blocks for the given duration, replaceable in tests together with the Clock
+type Sleeper func(time.Duration)
+
+// An Option configures the client in NewAPIClientWithOptions
+type Option func(*APIClient) error
+
+// Constructor function taking options, anything not set gets the same defaults as NewAPIClient and a timeout of DefaultTimeout.
+func NewAPIClientWithOptions(credentials string, opts ...Option) (*APIClient, error) {
+	c := NewAPIClient(credentials)
+	c.Timeout = DefaultTimeout
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Uses a copy of the given http.Client, e.g. for cookie jars or custom redirect policies.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *APIClient) error {
+		if client == nil {
+			return errors.New("WithHTTPClient: client is nil")
+		}
+		c.Client = *client
+		return nil
+	}
+}
+
+// Sets the transport of the http.Client, e.g. for proxies or custom TLS settings.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *APIClient) error {
+		if transport == nil {
+			return errors.New("WithTransport: transport is nil")
+		}
+		c.Transport = transport
+		return nil
+	}
+}
+
+// Sets the timeout of every request, 0 means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *APIClient) error {
+		if timeout < 0 {
+			return fmt.Errorf("WithTimeout: negative timeout %v", timeout)
+		}
+		c.Timeout = timeout
+		return nil
+	}
+}
+
+// Applies an environment preset, see TestEnvironment and the Production presets.
+func WithEnvironment(env Environment) Option {
+	return func(c *APIClient) error {
+		if err := validateBaseURL(env.URL); err != nil {
+			return err
+		}
+		c.SetEnvironment(env)
+		return nil
+	}
+}
+
+// Overrides the base URL, without the version part.
+func WithBaseURL(baseURL string) Option {
+	return func(c *APIClient) error {
+		if err := validateBaseURL(baseURL); err != nil {
+			return err
+		}
+		c.URL = strings.TrimRight(baseURL, "/")
+		return nil
+	}
+}
+
+// Overrides the API version.
+func WithVersion(version string) Option {
+	return func(c *APIClient) error {
+		if version == "" {
+			return errors.New("WithVersion: version is empty")
+		}
+		c.Version = version
+		return nil
+	}
+}
+
+// Sets the Accept-Language header, e.g. "sv" or "en".
+func WithLanguage(lang string) Option {
+	return func(c *APIClient) error {
+		if lang == "" {
+			return errors.New("WithLanguage: language is empty")
+		}
+		c.Language = lang
+		return nil
+	}
+}
+
+// Sets the User-Agent header.
+func WithUserAgent(userAgent string) Option {
+	return func(c *APIClient) error {
+		c.UserAgent = userAgent
+		return nil
+	}
+}
+
+// Uses the provider to generate fresh credentials on every login.
+func WithCredentialProvider(provider util.CredentialProvider) Option {
+	return func(c *APIClient) error {
+		if provider == nil {
+			return errors.New("WithCredentialProvider: provider is nil")
+		}
+		c.Provider = provider
+		return nil
+	}
+}
+
+// Waits on the limiter before every request.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(c *APIClient) error {
+		c.RateLimiter = limiter
+		return nil
+	}
+}
+
+// Retries failed requests according to the policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *APIClient) error {
+		c.RetryPolicy = policy
+		return nil
+	}
+}
+
+// Logs retries. Requests are only logged by LoggingMiddleware, which takes its own logger.
+func WithLogger(logger Logger) Option {
+	return func(c *APIClient) error {
+		c.Logger = logger
+		return nil
+	}
+}
+
+// Calls hook with the ResponseMeta of every response, which gives the typed endpoint methods access to
+// the status code, headers and rate limit hints that they otherwise drop. The hook runs before the
+// body is decoded, on the goroutine making the call.
+func WithResponseHook(hook func(*ResponseMeta)) Option {
+	return func(c *APIClient) error {
+		if hook == nil {
+			return errors.New("WithResponseHook: hook is nil")
+		}
+		c.ResponseHook = hook
+		return nil
+	}
+}
+
+// Replaces the clock used for timestamps, mostly useful in tests.
+func WithClock(clock Clock) Option {
+	return func(c *APIClient) error {
+		if clock == nil {
+			return errors.New("WithClock: clock is nil")
+		}
+		c.Clock = clock
+		return nil
+	}
+}
+
+// Replaces the sleep used for the wait between retries, use it with WithClock so a fake clock also controls the retries.
+func WithSleeper(sleep Sleeper) Option {
+	return func(c *APIClient) error {
+		if sleep == nil {
+			return errors.New("WithSleeper: sleeper is nil")
+		}
+		c.Sleeper = sleep
+		return nil
+	}
+}
+
+// Appends middleware to the chain wrapping every request, the first one added is the outermost.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *APIClient) error {
+		for _, m := range middleware {
+			if m == nil {
+				return errors.New("WithMiddleware: middleware is nil")
+			}
+		}
+		c.Middleware = append(c.Middleware, middleware...)
+		return nil
+	}
+}
+
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("Invalid base URL: %s", baseURL)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type retryFunc func(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool)
+
+func (f retryFunc) Retry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	return f(attempt, req, resp, err)
+}
+
+func TestNewAPIClientWithOptionsDefaults(t *testing.T) {
+	client, err := NewAPIClientWithOptions("SECRET")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, NNBASEURL, client.URL)
+	assert.Equal(t, NNAPIVERSION, client.Version)
+	assert.Equal(t, NNLANGUAGE, client.Language)
+	assert.Equal(t, "", client.Environment)
+	assert.Equal(t, DefaultTimeout, client.Timeout)
+	assert.Equal(t, "SECRET", client.Credentials)
+}
+
+func TestNewAPIClientWithOptionsValidation(t *testing.T) {
+	tests := []struct {
+		opt      Option
+		expected string
+	}{
+		{WithBaseURL("ftp://example.com"), "Invalid base URL: ftp://example.com"},
+		{WithBaseURL("/relative"), "Invalid base URL: /relative"},
+		{WithVersion(""), "WithVersion: version is empty"},
+		{WithLanguage(""), "WithLanguage: language is empty"},
+		{WithTimeout(-time.Second), "WithTimeout: negative timeout -1s"},
+		{WithHTTPClient(nil), "WithHTTPClient: client is nil"},
+		{WithTransport(nil), "WithTransport: transport is nil"},
+		{WithClock(nil), "WithClock: clock is nil"},
+		{WithSleeper(nil), "WithSleeper: sleeper is nil"},
+		{WithResponseHook(nil), "WithResponseHook: hook is nil"},
+		{WithMiddleware(nil), "WithMiddleware: middleware is nil"},
+		{WithCredentialProvider(nil), "WithCredentialProvider: provider is nil"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewAPIClientWithOptions("", tt.opt)
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestNewAPIClientWithOptionsRequest(t *testing.T) {
+	var headers http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		assert.Equal(t, "/3/markets", r.URL.Path)
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	client, err := NewAPIClientWithOptions("",
+		WithBaseURL(ts.URL+"/"),
+		WithVersion("3"),
+		WithLanguage("sv"),
+		WithUserAgent("test-agent"),
+		WithMiddleware(trace("outer"), trace("inner")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Markets(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "sv", headers.Get("Accept-Language"))
+	assert.Equal(t, "test-agent", headers.Get("User-Agent"))
+	assert.Equal(t, []string{"outer", "inner"}, order)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(429)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	policy := retryFunc(func(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+		return time.Millisecond, resp != nil && resp.StatusCode == 429
+	})
+
+	client, _ := NewAPIClientWithOptions("", WithBaseURL(ts.URL), WithRetryPolicy(policy))
+	if _, err := client.Markets(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDefaultRetryPolicyMaxRetries(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+
+	var slept []time.Duration
+	client, _ := NewAPIClientWithOptions("", WithBaseURL(ts.URL),
+		WithRetryPolicy(DefaultRetryPolicy{MaxRetries: 2, Backoff: time.Second}),
+		WithSleeper(func(d time.Duration) { slept = append(slept, d) }))
+
+	_, err := client.Markets()
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, slept)
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	policy := DefaultRetryPolicy{MaxRetries: 2, Backoff: time.Second}
+	get, _ := http.NewRequest("GET", "http://example.com", nil)
+	post, _ := http.NewRequest("POST", "http://example.com", nil)
+
+	tests := []struct {
+		attempt int
+		req     *http.Request
+		resp    *http.Response
+		err     error
+		wait    time.Duration
+		retry   bool
+	}{
+		{1, get, &http.Response{StatusCode: 429}, nil, TooManyRequestsWait, true},
+		{1, post, &http.Response{StatusCode: 429}, nil, TooManyRequestsWait, true},
+		{1, get, &http.Response{StatusCode: 503}, nil, time.Second, true},
+		{2, get, nil, errors.New("reset"), 2 * time.Second, true},
+		{1, post, &http.Response{StatusCode: 503}, nil, 0, false},
+		{1, post, nil, errors.New("reset"), 0, false},
+		{1, get, &http.Response{StatusCode: 404}, nil, 0, false},
+		{3, get, &http.Response{StatusCode: 429}, nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		wait, retry := policy.Retry(tt.attempt, tt.req, tt.resp, tt.err)
+		assert.Equal(t, tt.wait, wait)
+		assert.Equal(t, tt.retry, retry)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+
+	limiter := NewRateLimiter(2, time.Second).(*slidingLimiter)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	limiter.Wait()
+	now = now.Add(100 * time.Millisecond)
+	limiter.Wait()
+	limiter.Wait()
+
+	assert.Equal(t, []time.Duration{900 * time.Millisecond}, slept)
+}
+
+func TestClockOption(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	fixed := time.Unix(1000, 0)
+	client, _ := NewAPIClientWithOptions("", WithBaseURL(ts.URL), WithClock(func() time.Time { return fixed }))
+	if _, err := client.Markets(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fixed, client.LastUsageAt)
+}
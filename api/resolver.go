@@ -0,0 +1,259 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/denro/nordnet/util/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	InstrumentNotFoundError = errors.New("No instrument matched")
+
+	isinPattern       = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+	instrumentPattern = regexp.MustCompile(`^[0-9]+$`)
+	tradablePattern   = regexp.MustCompile(`^.+:[0-9]+$`)
+)
+
+// Returned when a query matches more than one instrument or tradable, the caller has to pick one of the candidates
+type AmbiguousError struct {
+	Query      string
+	Candidates []Resolution
+}
+
+// AmbiguousError implements the error interface
+func (e *AmbiguousError) Error() string {
+	ids := make([]string, len(e.Candidates))
+	for i, c := range e.Candidates {
+		ids[i] = fmt.Sprintf("%s (%s)", c.Instrument.Symbol, c.Tradable.TradableId)
+	}
+	return fmt.Sprintf("%q is ambiguous: %s", e.Query, strings.Join(ids, ", "))
+}
+
+// A resolved tradable together with its instrument
+type Resolution struct {
+	Instrument Instrument
+	Tradable   Tradable
+}
+
+// Resolver turns symbols, ISINs, instrument ids and identifier:market strings into tradables.
+// Results from the API are cached, use ClearCache to drop them.
+type Resolver struct {
+	Client *APIClient
+
+	// Pick the smart order tradable (market 80) when an instrument has one and no market is given
+	PreferSmartOrder bool
+
+	cache map[string][]Instrument
+	sync.Mutex
+}
+
+func NewResolver(client *APIClient) *Resolver {
+	return &Resolver{Client: client, cache: map[string][]Instrument{}}
+}
+
+// Resolves the query, which can be
+//
+//	an instrument id:      "16099874"
+//	an ISIN:               "SE0000108656"
+//	identifier:market_id:  "101:11"
+//	a symbol:              "ERIC B"
+//
+// Use ResolveSymbol or ResolveISIN to also restrict the market.
+func (r *Resolver) Resolve(query string) (*Resolution, error) {
+	query = strings.TrimSpace(query)
+
+	switch {
+	case instrumentPattern.MatchString(query):
+		id, err := strconv.ParseInt(query, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return r.ResolveInstrumentId(id, 0)
+	case isinPattern.MatchString(query):
+		return r.ResolveISIN(query, 0)
+	case tradablePattern.MatchString(query):
+		id, err := ParseTradableId(query)
+		if err != nil {
+			return nil, err
+		}
+		return r.ResolveTradable(id)
+	}
+
+	return r.ResolveSymbol(query, 0)
+}
+
+// Resolves a symbol, e.g. "ERIC B", optionally restricted to a market (0 means any).
+func (r *Resolver) ResolveSymbol(symbol string, marketId int64) (*Resolution, error) {
+	instruments, err := r.search(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []Instrument{}
+	for _, instrument := range instruments {
+		if strings.EqualFold(instrument.Symbol, symbol) {
+			matching = append(matching, instrument)
+		}
+	}
+
+	return r.pick(symbol, matching, marketId)
+}
+
+// Resolves an ISIN, optionally restricted to a market (0 means any).
+func (r *Resolver) ResolveISIN(isin string, marketId int64) (*Resolution, error) {
+	instruments, err := r.search(isin)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []Instrument{}
+	for _, instrument := range instruments {
+		if strings.EqualFold(instrument.IsinCode, isin) {
+			matching = append(matching, instrument)
+		}
+	}
+
+	return r.pick(isin, matching, marketId)
+}
+
+// Resolves an instrument id, optionally restricted to a market (0 means any).
+func (r *Resolver) ResolveInstrumentId(id, marketId int64) (*Resolution, error) {
+	key := fmt.Sprintf("instrument:%d", id)
+	instruments, err := r.cached(key, func() ([]Instrument, error) {
+		return r.Client.Instruments(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []Instrument{}
+	for _, instrument := range instruments {
+		if instrument.InstrumentId == id {
+			matching = append(matching, instrument)
+		}
+	}
+
+	return r.pick(strconv.FormatInt(id, 10), matching, marketId)
+}
+
+// Looks up the instrument that the tradable belongs to.
+func (r *Resolver) ResolveTradable(id TradableId) (*Resolution, error) {
+	lookup := id.URLParam()
+	instruments, err := r.cached("tradable:"+lookup, func() ([]Instrument, error) {
+		return r.Client.InstrumentLookup("market_id_identifier", lookup)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []Instrument{}
+	for _, instrument := range instruments {
+		for _, tradable := range instrument.Tradables {
+			if tradable.TradableId == id {
+				matching = append(matching, instrument)
+				break
+			}
+		}
+	}
+
+	return r.pick(id.String(), matching, id.MarketId)
+}
+
+// Drops all cached lookups
+func (r *Resolver) ClearCache() {
+	r.Lock()
+	defer r.Unlock()
+	r.cache = map[string][]Instrument{}
+}
+
+func (r *Resolver) search(query string) ([]Instrument, error) {
+	return r.cached("search:"+strings.ToUpper(query), func() ([]Instrument, error) {
+		return r.Client.SearchInstruments(&Params{"query": query})
+	})
+}
+
+func (r *Resolver) cached(key string, fetch func() ([]Instrument, error)) ([]Instrument, error) {
+	r.Lock()
+	if res, ok := r.cache[key]; ok {
+		r.Unlock()
+		return res, nil
+	}
+	r.Unlock()
+
+	res, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Lock()
+	if r.cache == nil {
+		r.cache = map[string][]Instrument{}
+	}
+	r.cache[key] = res
+	r.Unlock()
+
+	return res, nil
+}
+
+// Picks exactly one tradable among the instruments, or explains why it can't
+func (r *Resolver) pick(query string, instruments []Instrument, marketId int64) (*Resolution, error) {
+	candidates := []Resolution{}
+
+	for _, instrument := range instruments {
+		if tradable, ok := r.pickTradable(instrument, marketId); ok {
+			candidates = append(candidates, Resolution{instrument, tradable})
+		} else if marketId == 0 && len(instrument.Tradables) > 0 {
+			for _, tradable := range instrument.Tradables {
+				candidates = append(candidates, Resolution{instrument, tradable})
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, InstrumentNotFoundError
+	case 1:
+		return &candidates[0], nil
+	}
+
+	return nil, &AmbiguousError{query, candidates}
+}
+
+// Chooses the tradable of the instrument on the market, or the only primary listing when no market is given.
+// The smart order tradable is used if it is preferred or if it is the only one.
+func (r *Resolver) pickTradable(instrument Instrument, marketId int64) (Tradable, bool) {
+	var smart *Tradable
+	primary := []Tradable{}
+
+	for i, tradable := range instrument.Tradables {
+		if marketId != 0 {
+			if tradable.MarketId == marketId {
+				return tradable, true
+			}
+			continue
+		}
+
+		if tradable.MarketId == SmartOrderMarketId {
+			smart = &instrument.Tradables[i]
+		} else {
+			primary = append(primary, tradable)
+		}
+	}
+
+	if marketId != 0 {
+		return Tradable{}, false
+	}
+
+	if smart != nil && (r.PreferSmartOrder || len(primary) == 0) {
+		return *smart, true
+	}
+	if len(primary) == 1 {
+		return primary[0], true
+	}
+
+	return Tradable{}, false
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var resolverInstrumentsJSON = `[{
+		"instrument_id": 1,
+		"symbol": "ERIC B",
+		"isin_code": "SE0000108656",
+		"tradables": [
+			{"identifier": "101", "market_id": 11},
+			{"identifier": "101", "market_id": 80}
+		]
+	}, {
+		"instrument_id": 2,
+		"symbol": "DUAL",
+		"isin_code": "SE0000000002",
+		"tradables": [
+			{"identifier": "201", "market_id": 11},
+			{"identifier": "202", "market_id": 30}
+		]
+	}]`
+
+func setupResolver(t *testing.T) (*Resolver, *int) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/2/instruments", "/2/instruments/1", "/2/instruments/lookup/market_id_identifier/11:101":
+			w.Write([]byte(resolverInstrumentsJSON))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return NewResolver(&APIClient{URL: ts.URL, Version: NNAPIVERSION}), &requests
+}
+
+func TestResolveSymbol(t *testing.T) {
+	r, requests := setupResolver(t)
+
+	res, err := r.Resolve("ERIC B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, 1, res.Instrument.InstrumentId)
+	assert.EqualValues(t, 11, res.Tradable.MarketId)
+
+	r.PreferSmartOrder = true
+	res, err = r.Resolve("eric b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, 80, res.Tradable.MarketId)
+	assert.Equal(t, 1, *requests)
+}
+
+func TestResolveISIN(t *testing.T) {
+	r, _ := setupResolver(t)
+
+	res, err := r.Resolve("SE0000108656")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "101", res.Tradable.Identifier)
+}
+
+func TestResolveInstrumentIdAndTradable(t *testing.T) {
+	r, _ := setupResolver(t)
+
+	res, err := r.Resolve("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ERIC B", res.Instrument.Symbol)
+
+	res, err = r.Resolve("101:11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ERIC B", res.Instrument.Symbol)
+	assert.EqualValues(t, 11, res.Tradable.MarketId)
+}
+
+func TestResolveAmbiguous(t *testing.T) {
+	r, _ := setupResolver(t)
+
+	_, err := r.Resolve("DUAL")
+	if assert.IsType(t, &AmbiguousError{}, err) {
+		assert.Len(t, err.(*AmbiguousError).Candidates, 2)
+	}
+
+	res, err := r.ResolveSymbol("DUAL", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "202", res.Tradable.Identifier)
+
+	_, err = r.ResolveSymbol("DUAL", 99)
+	assert.Equal(t, InstrumentNotFoundError, err)
+
+	_, err = r.Resolve("MISSING")
+	assert.Equal(t, InstrumentNotFoundError, err)
+}
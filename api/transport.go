@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A RateLimiter is waited on before every request is sent.
+type RateLimiter interface {
+	Wait()
+}
+
+// Limits the number of requests to n per interval, requests over the limit block until there is room.
+func NewRateLimiter(n int, per time.Duration) RateLimiter {
+	if n < 1 {
+		n = 1
+	}
+	return &slidingLimiter{n: n, per: per, now: time.Now, sleep: time.Sleep}
+}
+
+type slidingLimiter struct {
+	n     int
+	per   time.Duration
+	sent  []time.Time
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	sync.Mutex
+}
+
+func (l *slidingLimiter) Wait() {
+	l.Lock()
+	defer l.Unlock()
+
+	for {
+		now := l.now()
+
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.per {
+			l.sent = l.sent[1:]
+		}
+
+		if len(l.sent) < l.n {
+			l.sent = append(l.sent, now)
+			return
+		}
+
+		l.sleep(l.per - now.Sub(l.sent[0]))
+	}
+}
+
+// A RetryPolicy decides if a request should be sent again, and after how long.
+// Attempt starts at 1 for the first retry, resp or err is set from the previous attempt.
+type RetryPolicy interface {
+	Retry(attempt int, req *http.Request, resp *http.Response, err error) (wait time.Duration, retry bool)
+}
+
+// Retries 429 Too Many Requests after the wait Nordnet asks for, and transport errors and 5xx
+// responses on GET requests with exponential backoff. Other methods are never retried on
+// errors since the server may have acted on them, e.g. entered an order.
+type DefaultRetryPolicy struct {
+	// Retries after the first request, MaxRetries 3 sends at most 4 requests
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// Wait used after 429 responses, as stated in TooManyRequestsError
+const TooManyRequestsWait = 10 * time.Second
+
+// DefaultRetryPolicy implements the RetryPolicy interface
+func (p DefaultRetryPolicy) Retry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt > p.MaxRetries {
+		return 0, false
+	}
+
+	if resp != nil && resp.StatusCode == 429 {
+		return TooManyRequestsWait, true
+	}
+
+	if req.Method != "GET" {
+		return 0, false
+	}
+
+	if err != nil || (resp != nil && resp.StatusCode >= 500) {
+		return p.Backoff << uint(attempt-1), true
+	}
+
+	return 0, false
+}
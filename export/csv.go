@@ -0,0 +1,89 @@
+/*
+Exports trades, positions and ledgers as CSV, JSON Lines and plain text accounting journals
+*/
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	. "github.com/denro/nordnet/util/models"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Writes every item as JSON on a line of its own
+func WriteJSONL[T any](w io.Writer, items []T) error {
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the trades as CSV with a header, times in RFC 3339 and UTC
+func WriteTradesCSV(w io.Writer, trades []Trade) error {
+	records := [][]string{{"accno", "trade_id", "order_id", "tradable", "side", "volume", "price", "currency", "tradetime", "counterparty"}}
+	for _, t := range trades {
+		records = append(records, []string{
+			formatInt(t.Accno), t.TradeId, formatInt(t.OrderId), t.Tradable.String(), t.Side.String(),
+			formatFloat(t.Volume), t.Price.Value.String(), t.Price.Currency, formatTime(t.Tradetime), t.Counterparty,
+		})
+	}
+	return writeCSV(w, records)
+}
+
+// Writes the positions as CSV with a header
+func WritePositionsCSV(w io.Writer, positions []Position) error {
+	records := [][]string{{
+		"accno", "instrument_id", "symbol", "isin_code", "qty",
+		"market_value", "currency", "market_value_acc", "account_currency", "acq_price", "acq_price_acc",
+	}}
+	for _, p := range positions {
+		records = append(records, []string{
+			formatInt(p.Accno), formatInt(p.Instrument.InstrumentId), p.Instrument.Symbol, p.Instrument.IsinCode, formatFloat(p.Qty),
+			p.MarketValue.Value.String(), p.MarketValue.Currency, p.MarketValueAcc.Value.String(), p.MarketValueAcc.Currency,
+			p.AcqPrice.Value.String(), p.AcqPriceAcc.Value.String(),
+		})
+	}
+	return writeCSV(w, records)
+}
+
+// Writes the ledgers of the account as CSV with a header, one row per currency
+func WriteLedgersCSV(w io.Writer, accno int64, infos []LedgerInformation) error {
+	records := [][]string{{"accno", "currency", "account_sum", "account_sum_acc", "account_currency", "exchange_rate"}}
+	for _, info := range infos {
+		for _, l := range info.Ledgers {
+			records = append(records, []string{
+				formatInt(accno), l.Currency, l.AccountSum.Value.String(),
+				l.AccountSumAcc.Value.String(), l.AccountSumAcc.Currency, l.ExchangeRate.Value.String(),
+			})
+		}
+	}
+	return writeCSV(w, records)
+}
+
+func writeCSV(w io.Writer, records [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatTime(t Timestamp) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Time().Format(time.RFC3339)
+}
@@ -0,0 +1,156 @@
+package export
+
+import (
+	"bytes"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var (
+	eric = Instrument{InstrumentId: 1, Symbol: "ERIC B", IsinCode: "SE0000108656", Currency: "SEK"}
+
+	trades = []Trade{
+		{Accno: 1, TradeId: "a", OrderId: 10, Tradable: TradableId{"101", 11}, Side: Buy, Volume: 100,
+			Price: Amount{MustDecimal("100.5"), "SEK"}, Tradetime: TimestampOf(time.Date(2023, 3, 1, 23, 30, 0, 0, time.UTC))},
+		{Accno: 1, TradeId: "b", OrderId: 11, Tradable: TradableId{"101", 11}, Side: Sell, Volume: 50,
+			Price: Amount{MustDecimal("120"), "SEK"}, Tradetime: TimestampOf(time.Date(2023, 3, 2, 10, 0, 0, 0, time.UTC))},
+	}
+
+	positions = []Position{
+		{Accno: 1, Instrument: eric, Qty: 50, MarketValue: Amount{MustDecimal("6000"), "SEK"}, MarketValueAcc: Amount{MustDecimal("6000"), "SEK"}},
+	}
+
+	ledgers = []LedgerInformation{{Ledgers: []Ledger{
+		{Currency: "SEK", AccountSum: Amount{MustDecimal("975"), "SEK"}, AccountSumAcc: Amount{MustDecimal("975"), "SEK"}, ExchangeRate: Amount{MustDecimal("1"), "SEK"}},
+	}}}
+
+	at = time.Date(2023, 3, 2, 17, 0, 0, 0, time.UTC)
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteTradesCSV(&buf, trades[:1]))
+	assert.Equal(t, "accno,trade_id,order_id,tradable,side,volume,price,currency,tradetime,counterparty\n"+
+		"1,a,10,101:11,BUY,100,100.5,SEK,2023-03-01T23:30:00Z,\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WritePositionsCSV(&buf, positions))
+	assert.Equal(t, "accno,instrument_id,symbol,isin_code,qty,market_value,currency,market_value_acc,account_currency,acq_price,acq_price_acc\n"+
+		"1,1,ERIC B,SE0000108656,50,6000,SEK,6000,SEK,0,0\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteLedgersCSV(&buf, 1, ledgers))
+	assert.Equal(t, "accno,currency,account_sum,account_sum_acc,account_currency,exchange_rate\n"+
+		"1,SEK,975,975,SEK,1\n", buf.String())
+}
+
+func TestJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteJSONL(&buf, []Amount{{MustDecimal("1.5"), "SEK"}, {MustDecimal("2"), "USD"}}))
+	assert.Equal(t, "{\"value\":1.5,\"currency\":\"SEK\"}\n{\"value\":2,\"currency\":\"USD\"}\n", buf.String())
+}
+
+func TestLedgerJournal(t *testing.T) {
+	journal := NewJournal(HLedgerFormat)
+	journal.Instruments = map[TradableId]Instrument{{"101", 11}: eric}
+
+	var buf bytes.Buffer
+	assert.NoError(t, journal.WriteTrades(&buf, trades))
+	assert.NoError(t, journal.WritePositions(&buf, positions, at))
+	assert.NoError(t, journal.WriteLedgers(&buf, 1, ledgers, at))
+	assert.Equal(t, `2023-03-02 * BUY 100 ERIC B
+    ; trade_id: a
+    Assets:Nordnet:1  100 "ERIC B" @ 100.5 SEK
+    Assets:Nordnet:1:Cash  -10050 SEK
+
+2023-03-02 * SELL 50 ERIC B
+    ; trade_id: b
+    Assets:Nordnet:1  -50 "ERIC B" @ 120 SEK
+    Assets:Nordnet:1:Cash  6000 SEK
+
+P 2023-03-02 "ERIC B" 120 SEK
+2023-03-02 * Balance
+    Assets:Nordnet:1  0 "ERIC B" = 50 "ERIC B"
+
+2023-03-02 * Balance
+    Assets:Nordnet:1:Cash  0 SEK = 975 SEK
+
+`, buf.String())
+}
+
+func TestBeancountJournal(t *testing.T) {
+	journal := NewJournal(BeancountFormat)
+	journal.Instruments = map[TradableId]Instrument{{"101", 11}: eric}
+	journal.Account = func(accno int64) string { return "Assets:Broker:Depot" }
+	journal.CashAccount = func(accno int64) string { return "Assets:Broker:Cash" }
+
+	var buf bytes.Buffer
+	assert.NoError(t, journal.WriteTrades(&buf, trades))
+	assert.NoError(t, journal.WritePositions(&buf, positions, at))
+	assert.Equal(t, `2023-03-02 * "BUY 100 ERIC B"
+  trade_id: "a"
+  Assets:Broker:Depot  100 ERIC-B {100.5 SEK}
+  Assets:Broker:Cash  -10050 SEK
+
+2023-03-02 * "SELL 50 ERIC B"
+  trade_id: "b"
+  Assets:Broker:Depot  -50 ERIC-B {} @ 120 SEK
+  Assets:Broker:Cash  6000 SEK
+  Income:Nordnet:Gains
+
+2023-03-02 price ERIC-B 120 SEK
+2023-03-03 balance Assets:Broker:Depot  50 ERIC-B
+`, buf.String())
+
+	journal.Commodity = ByIsin
+	assert.Equal(t, "SE0000108656", journal.commodity(eric))
+	assert.Equal(t, "X3M", journal.commodity(Instrument{Symbol: "3m."}))
+}
+
+func TestBeancountOpen(t *testing.T) {
+	journal := NewJournal(BeancountFormat)
+	journal.Instruments = map[TradableId]Instrument{{"101", 11}: eric}
+
+	lots := []Trade{
+		{Accno: 1, TradeId: "a", Tradable: TradableId{"101", 11}, Side: Buy, Volume: 100,
+			Price: Amount{MustDecimal("100"), "SEK"}, Tradetime: TimestampOf(time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC))},
+		{Accno: 1, TradeId: "b", Tradable: TradableId{"101", 11}, Side: Buy, Volume: 100,
+			Price: Amount{MustDecimal("110"), "SEK"}, Tradetime: TimestampOf(time.Date(2023, 3, 2, 10, 0, 0, 0, time.UTC))},
+		{Accno: 1, TradeId: "c", Tradable: TradableId{"101", 11}, Side: Sell, Volume: 50,
+			Price: Amount{MustDecimal("120"), "SEK"}, Tradetime: TimestampOf(time.Date(2023, 3, 3, 10, 0, 0, 0, time.UTC))},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, journal.WriteOpen(&buf, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), 1))
+	assert.NoError(t, journal.WriteTrades(&buf, lots))
+	assert.Equal(t, `2023-01-01 open Assets:Nordnet:1 "FIFO"
+2023-01-01 open Assets:Nordnet:1:Cash
+2023-01-01 open Income:Nordnet:Gains
+
+2023-03-01 * "BUY 100 ERIC B"
+  trade_id: "a"
+  Assets:Nordnet:1  100 ERIC-B {100 SEK}
+  Assets:Nordnet:1:Cash  -10000 SEK
+
+2023-03-02 * "BUY 100 ERIC B"
+  trade_id: "b"
+  Assets:Nordnet:1  100 ERIC-B {110 SEK}
+  Assets:Nordnet:1:Cash  -11000 SEK
+
+2023-03-03 * "SELL 50 ERIC B"
+  trade_id: "c"
+  Assets:Nordnet:1  -50 ERIC-B {} @ 120 SEK
+  Assets:Nordnet:1:Cash  6000 SEK
+  Income:Nordnet:Gains
+
+`, buf.String())
+
+	// the same accounts are only opened once, Ledger gets declarations
+	journal = NewJournal(LedgerFormat)
+	journal.Account = func(accno int64) string { return "Assets:Broker" }
+	buf.Reset()
+	assert.NoError(t, journal.WriteOpen(&buf, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), 1, 2))
+	assert.Equal(t, "account Assets:Broker\naccount Assets:Broker:Cash\n\n", buf.String())
+}
@@ -0,0 +1,244 @@
+package export
+
+import (
+	"fmt"
+	. "github.com/denro/nordnet/util/models"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Syntax of a plain text accounting journal
+type Format string
+
+const (
+	LedgerFormat Format = "ledger"
+
+	// hledger reads the Ledger format
+	HLedgerFormat Format = "hledger"
+
+	BeancountFormat Format = "beancount"
+)
+
+// Journal writes trades, positions and ledgers as plain text accounting entries. Holdings of all
+// commodities are kept in the account of the Nordnet account, cash in a sub account of it.
+type Journal struct {
+	Format Format
+
+	// Name of the account holding the instruments, Assets:Nordnet:<accno> if nil
+	Account func(accno int64) string
+
+	// Name of the account holding cash, the instrument account followed by :Cash if nil
+	CashAccount func(accno int64) string
+
+	// Balances the gains of sells in beancount, which books them at the cost of the lots sold
+	GainsAccount string
+
+	// Commodity symbol of an instrument, BySymbol if nil. It's adapted to the syntax of the format.
+	Commodity func(Instrument) string
+
+	// Instruments of the traded tradables, for their commodity. Trades of other tradables use the identifier.
+	Instruments map[TradableId]Instrument
+}
+
+func NewJournal(format Format) *Journal {
+	return &Journal{Format: format, GainsAccount: "Income:Nordnet:Gains"}
+}
+
+// Uses the symbol of the instrument as commodity, e.g. ERIC B
+func BySymbol(instrument Instrument) string {
+	return instrument.Symbol
+}
+
+// Uses the ISIN of the instrument as commodity, or the symbol if it has none
+func ByIsin(instrument Instrument) string {
+	if instrument.IsinCode != "" {
+		return instrument.IsinCode
+	}
+	return instrument.Symbol
+}
+
+// Opens the accounts used for the Nordnet accounts, before any other entry. Beancount rejects entries
+// in accounts that aren't opened, and the instrument account gets the FIFO booking method, which sells
+// need to pick among lots bought at different costs. Ledger and hledger get account declarations.
+func (j *Journal) WriteOpen(w io.Writer, at time.Time, accnos ...int64) error {
+	date := formatDate(at.In(CountryLocation("SE")))
+	written := map[string]bool{}
+
+	open := func(account, booking string) error {
+		if written[account] {
+			return nil
+		}
+		written[account] = true
+
+		var err error
+		switch {
+		case j.Format != BeancountFormat:
+			_, err = fmt.Fprintf(w, "account %s\n", account)
+		case booking != "":
+			_, err = fmt.Fprintf(w, "%s open %s %q\n", date, account, booking)
+		default:
+			_, err = fmt.Fprintf(w, "%s open %s\n", date, account)
+		}
+		return err
+	}
+
+	for _, accno := range accnos {
+		if err := open(j.account(accno), "FIFO"); err != nil {
+			return err
+		}
+		if err := open(j.cashAccount(accno), ""); err != nil {
+			return err
+		}
+	}
+	if j.Format == BeancountFormat {
+		if err := open(j.GainsAccount, ""); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// Writes a transaction per trade, booking the volume against cash at the trade price. For beancount the
+// accounts must be opened first, see WriteOpen, and sells reduce the lots by the booking method of the account.
+func (j *Journal) WriteTrades(w io.Writer, trades []Trade) error {
+	for _, t := range trades {
+		instrument, ok := j.Instruments[t.Tradable]
+		if !ok {
+			instrument = Instrument{Symbol: t.Tradable.Identifier}
+		}
+		commodity := j.commodity(instrument)
+
+		volume := DecimalFromFloat(t.Volume)
+		cash := Amount{t.Price.Value.Mul(volume), t.Price.Currency}
+		if t.Side == Buy {
+			cash = cash.Neg()
+		} else {
+			volume = volume.Neg()
+		}
+
+		account, cashAccount := j.account(t.Accno), j.cashAccount(t.Accno)
+		narration := fmt.Sprintf("%s %s %s", t.Side, formatFloat(t.Volume), instrument.Symbol)
+		date := formatDate(t.Tradetime.InCountry("SE"))
+
+		var err error
+		if j.Format == BeancountFormat {
+			price := fmt.Sprintf("{%s %s}", t.Price.Value, t.Price.Currency)
+			gains := ""
+			if t.Side == Sell {
+				price = fmt.Sprintf("{} @ %s %s", t.Price.Value, t.Price.Currency)
+				gains = fmt.Sprintf("  %s\n", j.GainsAccount)
+			}
+			_, err = fmt.Fprintf(w, "%s * %q\n  trade_id: %q\n  %s  %s %s %s\n  %s  %s %s\n%s\n",
+				date, narration, t.TradeId,
+				account, volume, commodity, price,
+				cashAccount, cash.Value, cash.Currency,
+				gains)
+		} else {
+			_, err = fmt.Fprintf(w, "%s * %s\n    ; trade_id: %s\n    %s  %s %s @ %s %s\n    %s  %s %s\n\n",
+				date, narration, t.TradeId,
+				account, volume, commodity, t.Price.Value, t.Price.Currency,
+				cashAccount, cash.Value, cash.Currency)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the price of every position and asserts its quantity, as at the end of the day
+func (j *Journal) WritePositions(w io.Writer, positions []Position, at time.Time) error {
+	date := formatDate(at.In(CountryLocation("SE")))
+	for _, p := range positions {
+		commodity := j.commodity(p.Instrument)
+		qty := formatFloat(p.Qty)
+
+		if p.Qty != 0 {
+			price := Amount{p.MarketValue.Value.Div(DecimalFromFloat(p.Qty)), p.MarketValue.Currency}
+			keyword := "P " + date
+			if j.Format == BeancountFormat {
+				keyword = date + " price"
+			}
+			if _, err := fmt.Fprintf(w, "%s %s %s %s\n", keyword, commodity, price.Value, price.Currency); err != nil {
+				return err
+			}
+		}
+		if err := j.writeBalance(w, at, j.account(p.Accno), qty, commodity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Asserts the cash balance of every currency of the account, as at the end of the day
+func (j *Journal) WriteLedgers(w io.Writer, accno int64, infos []LedgerInformation, at time.Time) error {
+	for _, info := range infos {
+		for _, l := range info.Ledgers {
+			if err := j.writeBalance(w, at, j.cashAccount(accno), l.AccountSum.Value.String(), j.commodity(Instrument{Symbol: l.Currency})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Beancount asserts balances at the start of the day, so the end of a day is the start of the next
+func (j *Journal) writeBalance(w io.Writer, at time.Time, account, qty, commodity string) error {
+	at = at.In(CountryLocation("SE"))
+	if j.Format == BeancountFormat {
+		_, err := fmt.Fprintf(w, "%s balance %s  %s %s\n", formatDate(at.AddDate(0, 0, 1)), account, qty, commodity)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s * Balance\n    %s  0 %s = %s %s\n\n", formatDate(at), account, commodity, qty, commodity)
+	return err
+}
+
+func (j *Journal) account(accno int64) string {
+	if j.Account != nil {
+		return j.Account(accno)
+	}
+	return fmt.Sprintf("Assets:Nordnet:%d", accno)
+}
+
+func (j *Journal) cashAccount(accno int64) string {
+	if j.CashAccount != nil {
+		return j.CashAccount(accno)
+	}
+	return j.account(accno) + ":Cash"
+}
+
+var (
+	ledgerPlain      = regexp.MustCompile(`^[A-Za-z]+$`)
+	beancountInvalid = regexp.MustCompile(`[^A-Z0-9'._-]+`)
+)
+
+// Quotes commodities with other characters than letters for Ledger, and replaces the characters
+// beancount doesn't allow with dashes
+func (j *Journal) commodity(instrument Instrument) string {
+	commodity := BySymbol(instrument)
+	if j.Commodity != nil {
+		commodity = j.Commodity(instrument)
+	}
+
+	if j.Format != BeancountFormat {
+		if ledgerPlain.MatchString(commodity) {
+			return commodity
+		}
+		return fmt.Sprintf("%q", commodity)
+	}
+
+	commodity = beancountInvalid.ReplaceAllString(strings.ToUpper(commodity), "-")
+	commodity = strings.TrimRight(commodity, "'._-")
+	if commodity == "" || commodity[0] < 'A' || commodity[0] > 'Z' {
+		commodity = "X" + commodity
+	}
+	return commodity
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
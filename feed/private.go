@@ -17,12 +17,35 @@ func NewPrivateFeed(address string) (*PrivateFeed, error) {
 	return &PrivateFeed{f}, nil
 }
 
+// Connects to the private feed given in the Login response and logs in with its session key
+func NewPrivateFeedFromLogin(login *models.Login, getState interface{}) (*PrivateFeed, error) {
+	pf, err := NewPrivateFeed(login.PrivateFeed.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pf.Login(login.SessionKey, getState); err != nil {
+		pf.Close()
+		return nil, err
+	}
+
+	return pf, nil
+}
+
 // Order data section in the private message
 type PrivateOrder models.Order
 
+func (o PrivateOrder) TradableId() models.TradableId {
+	return o.Tradable
+}
+
 // Trade data section in the private message
 type PrivateTrade models.Trade
 
+func (t PrivateTrade) TradableId() models.TradableId {
+	return t.Tradable
+}
+
 // Represents the messages sent on the private feed
 type PrivateMsg FeedMsg
 
@@ -58,6 +81,11 @@ func (pm *PrivateMsg) UnmarshalJSON(b []byte) (err error) {
 
 // Starts reading from the connection, returns channels for reading the messages and errors
 func (pf *PrivateFeed) Dispatch() (msgChan chan *PrivateMsg, errChan chan error) {
+	return pf.dispatch(nil)
+}
+
+// Like Dispatch, but the reading goroutine returns instead of sending once done is closed
+func (pf *PrivateFeed) dispatch(done <-chan struct{}) (msgChan chan *PrivateMsg, errChan chan error) {
 	msgChan = make(chan *PrivateMsg)
 	errChan = make(chan error)
 
@@ -70,9 +98,17 @@ func (pf *PrivateFeed) Dispatch() (msgChan chan *PrivateMsg, errChan chan error)
 		for {
 			pMsg = new(PrivateMsg)
 			if err = d.Decode(pMsg); err != nil {
-				ec <- err
+				select {
+				case ec <- err:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case mc <- pMsg:
+			case <-done:
+				return
 			}
-			msgChan <- pMsg
 		}
 	}(pf.decoder, msgChan, errChan)
 
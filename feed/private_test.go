@@ -58,7 +58,7 @@ var privateUnmarshalTests = []struct {
 		&PrivateMsg{"order", PrivateOrder{
 			Accno:               123,
 			OrderId:             123,
-			Price:               models.Amount{1.1, "test"},
+			Price:               models.Amount{models.MustDecimal("1.1"), "test"},
 			Volume:              1.1,
 			Tradable:            models.TradableId{"test", 123},
 			OpenVolume:          1.1,
@@ -66,7 +66,7 @@ var privateUnmarshalTests = []struct {
 			Side:                "test",
 			Modified:            123,
 			Reference:           "test",
-			ActivationCondition: models.ActivationCondition{"test", 1.1, 1.1, "test"},
+			ActivationCondition: models.ActivationCondition{"test", models.MustDecimal("1.1"), models.MustDecimal("1.1"), "test"},
 			PriceCondition:      "test",
 			VolumeCondition:     "test",
 			Validity:            models.Validity{"test", 123},
@@ -100,7 +100,7 @@ var privateUnmarshalTests = []struct {
 			OrderId:      123,
 			TradeId:      "test",
 			Tradable:     models.TradableId{"test", 123},
-			Price:        models.Amount{1.1, "test"},
+			Price:        models.Amount{models.MustDecimal("1.1"), "test"},
 			Volume:       1.1,
 			Side:         "test",
 			Counterparty: "test",
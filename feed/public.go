@@ -2,6 +2,7 @@ package feed
 
 import (
 	"encoding/json"
+	"github.com/denro/nordnet/util/models"
 )
 
 type PublicFeed struct {
@@ -17,6 +18,21 @@ func NewPublicFeed(address string) (*PublicFeed, error) {
 	return &PublicFeed{f}, err
 }
 
+// Connects to the public feed given in the Login response and logs in with its session key
+func NewPublicFeedFromLogin(login *models.Login) (*PublicFeed, error) {
+	pf, err := NewPublicFeed(login.PublicFeed.Address())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pf.Login(login.SessionKey, nil); err != nil {
+		pf.Close()
+		return nil, err
+	}
+
+	return pf, nil
+}
+
 // Arguments for subscribing to price updates
 type PriceArgs feedCmdArgs
 
@@ -49,6 +65,31 @@ type NewsArgs struct {
 	Delay bool   `json:"delay,omitempty"`
 }
 
+// Price subscription for the tradable
+func NewPriceArgs(id models.TradableId) PriceArgs {
+	return PriceArgs{T: priceType, I: id.Identifier, M: id.MarketId}
+}
+
+// Depth subscription for the tradable
+func NewDepthArgs(id models.TradableId) DepthArgs {
+	return DepthArgs{T: depthType, I: id.Identifier, M: id.MarketId}
+}
+
+// Trade subscription for the tradable
+func NewTradeArgs(id models.TradableId) TradeArgs {
+	return TradeArgs{T: tradeType, I: id.Identifier, M: id.MarketId}
+}
+
+// Trading status subscription for the tradable
+func NewTradingStatusArgs(id models.TradableId) TradingStatusArgs {
+	return TradingStatusArgs{T: tradingStatusType, I: id.Identifier, M: id.MarketId}
+}
+
+// Indicator subscription for the indicator
+func NewIndicatorArgs(id models.IndicatorId) IndicatorArgs {
+	return IndicatorArgs{T: indicatorType, I: id.Identifier, M: id.Src}
+}
+
 // Sends the Subscribe command with the given args
 func (f *PublicFeed) Subscribe(args interface{}) error {
 	return f.Write(&FeedCmd{Cmd: "subscribe", Args: args})
@@ -61,96 +102,116 @@ func (f *PublicFeed) Unsubscribe(args interface{}) error {
 
 // Price data section in the public message
 type PublicPrice struct {
-	I              string  `json:"i"`
-	M              int64   `json:"m"`
-	TradeTimestamp int64   `json:"trade_timestamp"`
-	TickTimestamp  int64   `json:"tick_timestamp"`
-	Bid            float64 `json:"bid"`
-	BidVolume      float64 `json:"bid_volume"`
-	Ask            float64 `json:"ask"`
-	AskVolume      float64 `json:"ask_volume"`
-	Close          float64 `json:"close"`
-	High           float64 `json:"high"`
-	Last           float64 `json:"last"`
-	LastVolume     float64 `json:"last_volume"`
-	Low            float64 `json:"low"`
-	Open           float64 `json:"open"`
-	Turnover       float64 `json:"turnover"`
-	TurnoverVolume float64 `json:"turnover_volume"`
-	EP             float64 `json:"ep"`
-	Paired         float64 `json:"paired"`
-	Imbalance      float64 `json:"imbalance"`
+	I              string           `json:"i"`
+	M              int64            `json:"m"`
+	TradeTimestamp models.Timestamp `json:"trade_timestamp"`
+	TickTimestamp  models.Timestamp `json:"tick_timestamp"`
+	Bid            models.Decimal   `json:"bid"`
+	BidVolume      float64          `json:"bid_volume"`
+	Ask            models.Decimal   `json:"ask"`
+	AskVolume      float64          `json:"ask_volume"`
+	Close          models.Decimal   `json:"close"`
+	High           models.Decimal   `json:"high"`
+	Last           models.Decimal   `json:"last"`
+	LastVolume     float64          `json:"last_volume"`
+	Low            models.Decimal   `json:"low"`
+	Open           models.Decimal   `json:"open"`
+	Turnover       models.Decimal   `json:"turnover"`
+	TurnoverVolume float64          `json:"turnover_volume"`
+	EP             models.Decimal   `json:"ep"`
+	Paired         float64          `json:"paired"`
+	Imbalance      float64          `json:"imbalance"`
+}
+
+func (p PublicPrice) TradableId() models.TradableId {
+	return models.TradableId{Identifier: p.I, MarketId: p.M}
 }
 
 // Trade data section in the public message
 type PublicTrade struct {
-	I              string  `json:"i"`
-	M              int64   `json:"m"`
-	TradeTimestamp int64   `json:"trade_timestamp"`
-	Price          float64 `json:"price"`
-	Volume         float64 `json:"volume"`
-	BrokerBuying   string  `json:"broker_buying"`
-	BrokerSelling  string  `json:"broker_selling"`
-	TradeId        string  `json:"trade_id"`
-	TradeType      string  `json:"trade_type"`
+	I              string           `json:"i"`
+	M              int64            `json:"m"`
+	TradeTimestamp models.Timestamp `json:"trade_timestamp"`
+	Price          models.Decimal   `json:"price"`
+	Volume         float64          `json:"volume"`
+	BrokerBuying   string           `json:"broker_buying"`
+	BrokerSelling  string           `json:"broker_selling"`
+	TradeId        string           `json:"trade_id"`
+	TradeType      string           `json:"trade_type"`
+}
+
+func (p PublicTrade) TradableId() models.TradableId {
+	return models.TradableId{Identifier: p.I, MarketId: p.M}
 }
 
 // Depth data section in the public message
 type PublicDepth struct {
-	I             string  `json:"i"`
-	M             int64   `json:"m"`
-	TickTimestamp int64   `json:"tick_timestamp"`
-	Bid1          float64 `json:"bid1"`
-	BidVolume1    float64 `json:"bid_volume1"`
-	Ask1          float64 `json:"ask1"`
-	AskVolume1    float64 `json:"ask_volume1"`
-	Bid2          float64 `json:"bid2"`
-	BidVolume2    float64 `json:"bid_volume2"`
-	Ask2          float64 `json:"ask2"`
-	AskVolume2    float64 `json:"ask_volume2"`
-	Bid3          float64 `json:"bid3"`
-	BidVolume3    float64 `json:"bid_volume3"`
-	Ask3          float64 `json:"ask3"`
-	AskVolume3    float64 `json:"ask_volume3"`
-	Bid4          float64 `json:"bid4"`
-	BidVolume4    float64 `json:"bid_volume4"`
-	Ask4          float64 `json:"ask4"`
-	AskVolume4    float64 `json:"ask_volume4"`
-	Bid5          float64 `json:"bid5"`
-	BidVolume5    float64 `json:"bid_volume5"`
-	Ask5          float64 `json:"ask5"`
-	AskVolume5    float64 `json:"ask_volume5"`
+	I             string           `json:"i"`
+	M             int64            `json:"m"`
+	TickTimestamp models.Timestamp `json:"tick_timestamp"`
+	Bid1          models.Decimal   `json:"bid1"`
+	BidVolume1    float64          `json:"bid_volume1"`
+	Ask1          models.Decimal   `json:"ask1"`
+	AskVolume1    float64          `json:"ask_volume1"`
+	Bid2          models.Decimal   `json:"bid2"`
+	BidVolume2    float64          `json:"bid_volume2"`
+	Ask2          models.Decimal   `json:"ask2"`
+	AskVolume2    float64          `json:"ask_volume2"`
+	Bid3          models.Decimal   `json:"bid3"`
+	BidVolume3    float64          `json:"bid_volume3"`
+	Ask3          models.Decimal   `json:"ask3"`
+	AskVolume3    float64          `json:"ask_volume3"`
+	Bid4          models.Decimal   `json:"bid4"`
+	BidVolume4    float64          `json:"bid_volume4"`
+	Ask4          models.Decimal   `json:"ask4"`
+	AskVolume4    float64          `json:"ask_volume4"`
+	Bid5          models.Decimal   `json:"bid5"`
+	BidVolume5    float64          `json:"bid_volume5"`
+	Ask5          models.Decimal   `json:"ask5"`
+	AskVolume5    float64          `json:"ask_volume5"`
+}
+
+func (p PublicDepth) TradableId() models.TradableId {
+	return models.TradableId{Identifier: p.I, MarketId: p.M}
 }
 
 // Trading Status data section in the public message
 type PublicTradingStatus struct {
-	I             string `json:"i"`
-	M             int64  `json:"m"`
-	TickTimestamp int64  `json:"tick_timestamp"`
-	Status        string `json:"status"`
-	SourceStatus  string `json:"source_status"`
-	Halted        string `json:"halted"`
+	I             string           `json:"i"`
+	M             int64            `json:"m"`
+	TickTimestamp models.Timestamp `json:"tick_timestamp"`
+	Status        string           `json:"status"`
+	SourceStatus  string           `json:"source_status"`
+	Halted        string           `json:"halted"`
+}
+
+func (p PublicTradingStatus) TradableId() models.TradableId {
+	return models.TradableId{Identifier: p.I, MarketId: p.M}
 }
 
 // Indicator data section in the public message
 type PublicIndicator struct {
-	I             string  `json:"i"`
-	M             string  `json:"m"`
-	TickTimestamp int64   `json:"tick_timestamp"`
-	High          float64 `json:"high"`
-	Low           float64 `json:"low"`
-	Last          float64 `json:"last"`
-	Close         float64 `json:"close"`
+	I             string           `json:"i"`
+	M             string           `json:"m"`
+	TickTimestamp models.Timestamp `json:"tick_timestamp"`
+	High          models.Decimal   `json:"high"`
+	Low           models.Decimal   `json:"low"`
+	Last          models.Decimal   `json:"last"`
+	Close         models.Decimal   `json:"close"`
+}
+
+func (p PublicIndicator) IndicatorId() models.IndicatorId {
+	return models.IndicatorId{Src: p.M, Identifier: p.I}
 }
 
 // News data section in the public message
 type PublicNews struct {
-	ItemId      string   `json:"itemid"`
-	Lang        string   `json:"lang"`
-	Datetime    string   `json:"datetime"`
-	SourceId    string   `json:"sourceid"`
-	Headline    string   `json:"headline"`
-	Instruments []string `json:"instruments"`
+	ItemId      string                  `json:"itemid"`
+	Lang        string                  `json:"lang"`
+	Datetime    models.SwedishTimestamp `json:"datetime"`
+	SourceId    string                  `json:"sourceid"`
+	Headline    string                  `json:"headline"`
+	Instruments []string                `json:"instruments"`
 }
 
 // Represents the messages sent on the public feed
@@ -3,8 +3,10 @@ package feed
 import (
 	"bytes"
 	"encoding/json"
+	"github.com/denro/nordnet/util/models"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 var publicUnmarshalTests = []struct {
@@ -45,19 +47,19 @@ var publicUnmarshalTests = []struct {
 			M:              123,
 			TradeTimestamp: 123,
 			TickTimestamp:  123,
-			Bid:            1.1,
+			Bid:            models.MustDecimal("1.1"),
 			BidVolume:      1.1,
-			Ask:            1.1,
+			Ask:            models.MustDecimal("1.1"),
 			AskVolume:      1.1,
-			Close:          1.1,
-			High:           1.1,
-			Last:           1.1,
+			Close:          models.MustDecimal("1.1"),
+			High:           models.MustDecimal("1.1"),
+			Last:           models.MustDecimal("1.1"),
 			LastVolume:     1.1,
-			Low:            1.1,
-			Open:           1.1,
-			Turnover:       1.1,
+			Low:            models.MustDecimal("1.1"),
+			Open:           models.MustDecimal("1.1"),
+			Turnover:       models.MustDecimal("1.1"),
 			TurnoverVolume: 1.1,
-			EP:             1.1,
+			EP:             models.MustDecimal("1.1"),
 			Paired:         1.1,
 			Imbalance:      1.1,
 		}},
@@ -81,7 +83,7 @@ var publicUnmarshalTests = []struct {
 			I:              "test",
 			M:              123,
 			TradeTimestamp: 123,
-			Price:          1.1,
+			Price:          models.MustDecimal("1.1"),
 			Volume:         1.1,
 			BrokerBuying:   "test",
 			BrokerSelling:  "test",
@@ -122,25 +124,25 @@ var publicUnmarshalTests = []struct {
 			I:             "test",
 			M:             123,
 			TickTimestamp: 123,
-			Bid1:          1.1,
+			Bid1:          models.MustDecimal("1.1"),
 			BidVolume1:    1.1,
-			Ask1:          1.1,
+			Ask1:          models.MustDecimal("1.1"),
 			AskVolume1:    1.1,
-			Bid2:          1.1,
+			Bid2:          models.MustDecimal("1.1"),
 			BidVolume2:    1.1,
-			Ask2:          1.1,
+			Ask2:          models.MustDecimal("1.1"),
 			AskVolume2:    1.1,
-			Bid3:          1.1,
+			Bid3:          models.MustDecimal("1.1"),
 			BidVolume3:    1.1,
-			Ask3:          1.1,
+			Ask3:          models.MustDecimal("1.1"),
 			AskVolume3:    1.1,
-			Bid4:          1.1,
+			Bid4:          models.MustDecimal("1.1"),
 			BidVolume4:    1.1,
-			Ask4:          1.1,
+			Ask4:          models.MustDecimal("1.1"),
 			AskVolume4:    1.1,
-			Bid5:          1.1,
+			Bid5:          models.MustDecimal("1.1"),
 			BidVolume5:    1.1,
-			Ask5:          1.1,
+			Ask5:          models.MustDecimal("1.1"),
 			AskVolume5:    1.1,
 		}},
 	},
@@ -182,10 +184,10 @@ var publicUnmarshalTests = []struct {
 			I:             "test",
 			M:             "test",
 			TickTimestamp: 123,
-			High:          1.1,
-			Low:           1.1,
-			Last:          1.1,
-			Close:         1.1,
+			High:          models.MustDecimal("1.1"),
+			Low:           models.MustDecimal("1.1"),
+			Last:          models.MustDecimal("1.1"),
+			Close:         models.MustDecimal("1.1"),
 		}},
 	},
 	{
@@ -194,7 +196,7 @@ var publicUnmarshalTests = []struct {
 			"data": {
 				"itemid": "test",
 				"lang": "test",
-				"datetime": "test",
+				"datetime": "2015-01-29 10:57:03",
 				"sourceid": "test",
 				"headline": "test",
 				"instruments": ["test"]
@@ -203,7 +205,7 @@ var publicUnmarshalTests = []struct {
 		&PublicMsg{"news", PublicNews{
 			ItemId:      "test",
 			Lang:        "test",
-			Datetime:    "test",
+			Datetime:    models.SwedishTimestamp{Timestamp: 1422525423000},
 			SourceId:    "test",
 			Headline:    "test",
 			Instruments: []string{"test"},
@@ -395,3 +397,29 @@ func TestUnsubscribe(t *testing.T) {
 		assert.Equal(t, tt.expected+string('\n'), b.String())
 	}
 }
+
+func TestTradableIdentity(t *testing.T) {
+	id := models.TradableId{Identifier: "1869", MarketId: 30}
+
+	assert.Equal(t, PriceArgs{T: "price", I: "1869", M: 30}, NewPriceArgs(id))
+	assert.Equal(t, DepthArgs{T: "depth", I: "1869", M: 30}, NewDepthArgs(id))
+	assert.Equal(t, TradeArgs{T: "trade", I: "1869", M: 30}, NewTradeArgs(id))
+	assert.Equal(t, TradingStatusArgs{T: "trading_status", I: "1869", M: 30}, NewTradingStatusArgs(id))
+	assert.Equal(t, IndicatorArgs{T: "indicator", I: "SIX-IdX-DJI", M: "SIX"}, NewIndicatorArgs(models.IndicatorId{Src: "SIX", Identifier: "SIX-IdX-DJI"}))
+
+	assert.Equal(t, id, PublicPrice{I: "1869", M: 30}.TradableId())
+	assert.Equal(t, id, PublicDepth{I: "1869", M: 30}.TradableId())
+	assert.Equal(t, id, PublicTrade{I: "1869", M: 30}.TradableId())
+	assert.Equal(t, id, PublicTradingStatus{I: "1869", M: 30}.TradableId())
+	assert.Equal(t, id, PrivateOrder{Tradable: id}.TradableId())
+	assert.Equal(t, id, PrivateTrade{Tradable: id}.TradableId())
+	assert.Equal(t, "SIX:SIX-IdX-DJI", PublicIndicator{I: "SIX-IdX-DJI", M: "SIX"}.IndicatorId().String())
+}
+
+func TestPublicNewsTime(t *testing.T) {
+	var news PublicNews
+	assert.NoError(t, json.Unmarshal([]byte(`{"datetime":"2015-01-29T10:57:03+01:00"}`), &news))
+	assert.Equal(t, time.Date(2015, 1, 29, 9, 57, 3, 0, time.UTC), news.Datetime.Time())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"datetime":"test"}`), &news))
+}
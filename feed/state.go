@@ -0,0 +1,83 @@
+package feed
+
+import (
+	"sort"
+	"time"
+)
+
+// Time without messages after which the initial state is considered complete, when no heartbeat arrives first
+const DefaultStateQuietPeriod = 2 * time.Second
+
+// The orders and trades sent by the private feed right after logging in with a GetState.
+// Every order is included once in its latest state, orders are sorted by id and trades by trade time.
+type PrivateState struct {
+	Orders []PrivateOrder
+	Trades []PrivateTrade
+}
+
+// Starts reading like Dispatch, but first collects the initial state sent after logging in with a GetState.
+// The state is complete at the first heartbeat, or when no message arrived for the quiet period
+// (DefaultStateQuietPeriod if 0). Everything after that boundary is delivered on msgChan as live updates,
+// so the state can be applied before any live message without racing it.
+//
+// If reading fails before the state is complete the error is returned and the feed should be closed.
+// The reading goroutine then stops at its next message, at the latest when the feed is closed.
+func (pf *PrivateFeed) DispatchState(quiet time.Duration) (state *PrivateState, msgChan chan *PrivateMsg, errChan chan error, err error) {
+	if quiet <= 0 {
+		quiet = DefaultStateQuietPeriod
+	}
+
+	done := make(chan struct{})
+	msgChan, errChan = pf.dispatch(done)
+
+	orders := map[int64]PrivateOrder{}
+	trades := map[string]PrivateTrade{}
+
+	timer := time.NewTimer(quiet)
+	defer timer.Stop()
+
+collect:
+	for {
+		select {
+		case msg := <-msgChan:
+			switch data := msg.Data.(type) {
+			case PrivateOrder:
+				if current, ok := orders[data.OrderId]; !ok || data.Modified >= current.Modified {
+					orders[data.OrderId] = data
+				}
+			case PrivateTrade:
+				trades[data.TradeId] = data
+			}
+			if msg.Type == heartbeatType {
+				break collect
+			}
+		case err = <-errChan:
+			close(done)
+			return nil, nil, nil, err
+		case <-timer.C:
+			break collect
+		}
+
+		if !timer.Stop() {
+			<-timer.C
+		}
+		timer.Reset(quiet)
+	}
+
+	state = &PrivateState{Orders: []PrivateOrder{}, Trades: []PrivateTrade{}}
+	for _, order := range orders {
+		state.Orders = append(state.Orders, order)
+	}
+	for _, trade := range trades {
+		state.Trades = append(state.Trades, trade)
+	}
+	sort.Slice(state.Orders, func(i, j int) bool { return state.Orders[i].OrderId < state.Orders[j].OrderId })
+	sort.Slice(state.Trades, func(i, j int) bool {
+		if state.Trades[i].Tradetime != state.Trades[j].Tradetime {
+			return state.Trades[i].Tradetime < state.Trades[j].Tradetime
+		}
+		return state.Trades[i].TradeId < state.Trades[j].TradeId
+	})
+
+	return state, msgChan, errChan, nil
+}
@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDispatchState(t *testing.T) {
+	b := &fakeConnection{&bytes.Buffer{}}
+	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	feed := &PrivateFeed{f}
+
+	b.WriteString(`{"type":"order","data":{"order_id":2,"modified":200,"order_state":"ON_MARKET"}}
+{"type":"order","data":{"order_id":1,"modified":100,"order_state":"ON_MARKET"}}
+{"type":"trade","data":{"trade_id":"b","order_id":1,"tradetime":150}}
+{"type":"order","data":{"order_id":1,"modified":150,"order_state":"DONE"}}
+{"type":"trade","data":{"trade_id":"a","order_id":1,"tradetime":120}}
+{"type":"heartbeat","data":{}}
+{"type":"order","data":{"order_id":3,"modified":300}}
+`)
+
+	state, msgChan, _, err := feed.DispatchState(time.Second)
+	assert.NoError(t, err)
+
+	assert.Len(t, state.Orders, 2)
+	assert.EqualValues(t, 1, state.Orders[0].OrderId)
+	assert.EqualValues(t, "DONE", state.Orders[0].OrderState)
+	assert.EqualValues(t, 2, state.Orders[1].OrderId)
+
+	assert.Len(t, state.Trades, 2)
+	assert.Equal(t, "a", state.Trades[0].TradeId)
+	assert.Equal(t, "b", state.Trades[1].TradeId)
+
+	msg := <-msgChan
+	assert.EqualValues(t, 3, msg.Data.(PrivateOrder).OrderId)
+}
+
+type blockingConnection struct {
+	*bytes.Buffer
+	read chan struct{}
+}
+
+func (c *blockingConnection) Read(p []byte) (int, error) {
+	if c.Buffer.Len() == 0 {
+		<-c.read
+		return 0, errors.New("closed")
+	}
+	return c.Buffer.Read(p)
+}
+
+func (c *blockingConnection) Close() error {
+	close(c.read)
+	return nil
+}
+
+func TestDispatchStateQuietPeriod(t *testing.T) {
+	b := &blockingConnection{&bytes.Buffer{}, make(chan struct{})}
+	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	feed := &PrivateFeed{f}
+
+	b.WriteString(`{"type":"order","data":{"order_id":1,"modified":100}}` + "\n")
+
+	state, _, _, err := feed.DispatchState(10 * time.Millisecond)
+	assert.NoError(t, err)
+	assert.Len(t, state.Orders, 1)
+	assert.Empty(t, state.Trades)
+}
+
+func TestDispatchStateError(t *testing.T) {
+	b := &fakeConnection{&bytes.Buffer{}}
+	f := &Feed{b, json.NewEncoder(b), json.NewDecoder(b)}
+	feed := &PrivateFeed{f}
+
+	b.WriteString(`{"type":"order","data":{"order_id":1}}` + "\n" + `{"type":`)
+
+	before := runtime.NumGoroutine()
+	state, _, _, err := feed.DispatchState(time.Second)
+	assert.Error(t, err)
+	assert.Nil(t, state)
+
+	// The reading goroutine must not stay blocked on the channels nobody reads
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, before, runtime.NumGoroutine())
+}
@@ -0,0 +1,237 @@
+/*
+Converts amounts between currencies with the exchange rates of the account ledgers, or of FX instruments on the public feed
+*/
+package fx
+
+import (
+	"fmt"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sources of rates
+const (
+	SourceLedger = "ledger"
+	SourceFeed   = "feed"
+	SourceCross  = "cross"
+)
+
+// 1 unit of From is worth Value units of To, as known at At
+type Rate struct {
+	From, To string
+	Value    Decimal
+	At       time.Time
+	Source   string
+}
+
+// Returned when no rate between the currencies is known
+type MissingRateError struct {
+	From, To string
+}
+
+// MissingRateError implements the error interface
+func (e MissingRateError) Error() string {
+	return fmt.Sprintf("No exchange rate from %s to %s", e.From, e.To)
+}
+
+// A converted amount and the rate used
+type Converted struct {
+	Amount Amount
+	Rate   Rate
+}
+
+// Converter is what portfolio, risk and reporting code depends on, implemented by Table
+type Converter interface {
+	Convert(amount Amount, to string) (Converted, error)
+}
+
+// Implemented by api.APIClient
+type LedgerLister interface {
+	AccountLedgers(accountno int64) ([]LedgerInformation, error)
+}
+
+// Table holds the latest rate for every currency pair. Rates are stored in both directions, and
+// pairs without a rate are converted through a currency both have a rate to.
+type Table struct {
+	// Used as the time of ledger rates, which have no timestamp of their own, time.Now if nil
+	Clock func() time.Time
+
+	rates       map[[2]string]Rate
+	instruments map[TradableId][2]string
+
+	sync.RWMutex
+}
+
+func NewTable() *Table {
+	return &Table{}
+}
+
+// Fetches the ledgers of the accounts and adds their rates to a new table
+func LoadLedgers(client LedgerLister, accnos ...int64) (*Table, error) {
+	t := NewTable()
+	if err := t.Refresh(client, accnos...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Fetches the ledgers of the accounts again and updates the rates
+func (t *Table) Refresh(client LedgerLister, accnos ...int64) error {
+	for _, accno := range accnos {
+		infos, err := client.AccountLedgers(accno)
+		if err != nil {
+			return err
+		}
+		t.AddLedgers(infos...)
+	}
+	return nil
+}
+
+// Adds the exchange rates of the ledgers, the rate of a ledger converts its currency to the account currency.
+// Ledger rates are only refreshed by Nordnet now and then, so they never replace a rate from another source.
+func (t *Table) AddLedgers(infos ...LedgerInformation) {
+	at := t.now()
+	for _, info := range infos {
+		for _, ledger := range info.Ledgers {
+			t.Set(Rate{ledger.Currency, ledger.ExchangeRate.Currency, ledger.ExchangeRate.Value, at, SourceLedger})
+		}
+	}
+}
+
+// Sets the rate and its inverse. A ledger rate never replaces a rate from another source and is always
+// replaced by one, otherwise the rate is set unless a newer one for the pair is known. Zero rates and rates
+// between the same currency are ignored.
+func (t *Table) Set(rate Rate) {
+	if rate.Value.Sign() <= 0 || rate.From == "" || rate.To == "" || rate.From == rate.To {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.rates == nil {
+		t.rates = map[[2]string]Rate{}
+	}
+	if current, ok := t.rates[[2]string{rate.From, rate.To}]; ok {
+		fromLedger, currentFromLedger := rate.Source == SourceLedger, current.Source == SourceLedger
+		if fromLedger && !currentFromLedger {
+			return
+		}
+		if fromLedger == currentFromLedger && current.At.After(rate.At) {
+			return
+		}
+	}
+
+	t.rates[[2]string{rate.From, rate.To}] = rate
+	t.rates[[2]string{rate.To, rate.From}] = Rate{rate.To, rate.From, DecimalFromInt(1).Div(rate.Value), rate.At, rate.Source}
+}
+
+// Uses the last price of the tradable as the rate from one currency to another, e.g. an EUR/SEK cross.
+// Subscribe to its prices with feed.NewPriceArgs and pass the messages to HandlePublic.
+func (t *Table) Track(id TradableId, from, to string) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.instruments == nil {
+		t.instruments = map[TradableId][2]string{}
+	}
+	t.instruments[id] = [2]string{from, to}
+}
+
+// Updates the rates of tracked tradables from price messages and ignores the rest
+func (t *Table) HandlePublic(msg *feed.PublicMsg) {
+	price, ok := msg.Data.(feed.PublicPrice)
+	if !ok {
+		return
+	}
+
+	t.RLock()
+	pair, tracked := t.instruments[price.TradableId()]
+	t.RUnlock()
+	if !tracked {
+		return
+	}
+
+	at := price.TickTimestamp.Time()
+	if at.IsZero() {
+		at = t.now()
+	}
+	t.Set(Rate{pair[0], pair[1], price.Last, at, SourceFeed})
+}
+
+// Returns the rate between the currencies. A cross rate through another currency gets the time of the
+// older of its two rates.
+func (t *Table) Rate(from, to string) (Rate, error) {
+	if from == to {
+		return Rate{from, to, DecimalFromInt(1), t.now(), ""}, nil
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	if rate, ok := t.rates[[2]string{from, to}]; ok {
+		return rate, nil
+	}
+
+	via := []string{}
+	for pair := range t.rates {
+		if pair[0] == from {
+			via = append(via, pair[1])
+		}
+	}
+	sort.Strings(via)
+
+	for _, currency := range via {
+		// dividing by the rate back from to loses less precision than multiplying by an inverse
+		second, ok := t.rates[[2]string{to, currency}]
+		if !ok {
+			continue
+		}
+		first := t.rates[[2]string{from, currency}]
+
+		at := first.At
+		if second.At.Before(at) {
+			at = second.At
+		}
+		return Rate{from, to, first.Value.Div(second.Value), at, SourceCross}, nil
+	}
+
+	return Rate{}, MissingRateError{from, to}
+}
+
+// Table implements the Converter interface
+func (t *Table) Convert(amount Amount, to string) (Converted, error) {
+	rate, err := t.Rate(amount.Currency, to)
+	if err != nil {
+		return Converted{}, err
+	}
+	return Converted{Amount{amount.Value.Mul(rate.Value), to}, rate}, nil
+}
+
+// Returns all known rates sorted by currency pair
+func (t *Table) Rates() []Rate {
+	t.RLock()
+	defer t.RUnlock()
+
+	res := []Rate{}
+	for _, rate := range t.rates {
+		res = append(res, rate)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].From != res[j].From {
+			return res[i].From < res[j].From
+		}
+		return res[i].To < res[j].To
+	})
+	return res
+}
+
+func (t *Table) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
@@ -0,0 +1,160 @@
+package fx
+
+import (
+	"errors"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type ledgersFunc func(accountno int64) ([]LedgerInformation, error)
+
+func (f ledgersFunc) AccountLedgers(accountno int64) ([]LedgerInformation, error) {
+	return f(accountno)
+}
+
+func d(s string) Decimal {
+	return MustDecimal(s)
+}
+
+func testLedgers(accountno int64) ([]LedgerInformation, error) {
+	if accountno != 1 {
+		return nil, errors.New("unknown account")
+	}
+	return []LedgerInformation{{Ledgers: []Ledger{
+		{Currency: "SEK", ExchangeRate: Amount{d("1"), "SEK"}},
+		{Currency: "USD", ExchangeRate: Amount{d("10"), "SEK"}},
+		{Currency: "EUR", ExchangeRate: Amount{d("11"), "SEK"}},
+	}}}, nil
+}
+
+func TestTableLedgers(t *testing.T) {
+	at := time.Unix(1000, 0)
+	table := NewTable()
+	table.Clock = func() time.Time { return at }
+	assert.NoError(t, table.Refresh(ledgersFunc(testLedgers), 1))
+
+	converted, err := table.Convert(Amount{d("15"), "USD"}, "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("150"), "SEK"}, converted.Amount)
+	assert.Equal(t, Rate{"USD", "SEK", d("10"), at, SourceLedger}, converted.Rate)
+
+	converted, err = table.Convert(Amount{d("150"), "SEK"}, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("15"), "USD"}, converted.Amount)
+
+	converted, err = table.Convert(Amount{d("1"), "SEK"}, "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("1"), "SEK"}, converted.Amount)
+
+	assert.Len(t, table.Rates(), 4)
+
+	_, err = LoadLedgers(ledgersFunc(testLedgers), 2)
+	assert.EqualError(t, err, "unknown account")
+}
+
+func TestTableCrossRates(t *testing.T) {
+	table := NewTable()
+	table.Set(Rate{"USD", "SEK", d("10"), time.Unix(2000, 0), SourceLedger})
+	table.Set(Rate{"EUR", "SEK", d("11"), time.Unix(1000, 0), SourceLedger})
+
+	rate, err := table.Rate("USD", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceCross, rate.Source)
+	assert.Equal(t, time.Unix(1000, 0), rate.At)
+	assert.Equal(t, "0.90909091", rate.Value.Round(8).String())
+
+	_, err = table.Rate("USD", "NOK")
+	assert.Equal(t, MissingRateError{"USD", "NOK"}, err)
+	assert.EqualError(t, err, "No exchange rate from USD to NOK")
+
+	// an older rate doesn't replace a newer one
+	table.Set(Rate{"USD", "SEK", d("9"), time.Unix(1500, 0), SourceLedger})
+	rate, _ = table.Rate("SEK", "USD")
+	assert.Equal(t, d("0.1"), rate.Value)
+}
+
+func TestTableFeed(t *testing.T) {
+	table := NewTable()
+	id := TradableId{"EURSEK", 12}
+	table.Track(id, "EUR", "SEK")
+
+	table.HandlePublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "EURSEK", M: 12, Last: d("11.5"), TickTimestamp: 5000}})
+	table.HandlePublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "OTHER", M: 12, Last: d("1")}})
+	table.HandlePublic(&feed.PublicMsg{Type: "heartbeat", Data: struct{}{}})
+
+	converted, err := table.Convert(Amount{d("2"), "EUR"}, "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("23"), "SEK"}, converted.Amount)
+	assert.Equal(t, Rate{"EUR", "SEK", d("11.5"), time.Unix(5, 0).UTC(), SourceFeed}, converted.Rate)
+	assert.Len(t, table.Rates(), 2)
+
+	// refreshing the ledgers later doesn't replace the feed rate
+	table.Clock = func() time.Time { return time.Unix(10, 0) }
+	assert.NoError(t, table.Refresh(ledgersFunc(testLedgers), 1))
+	rate, err := table.Rate("EUR", "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, Rate{"EUR", "SEK", d("11.5"), time.Unix(5, 0).UTC(), SourceFeed}, rate)
+	rate, err = table.Rate("USD", "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceLedger, rate.Source)
+}
+
+func TestTableFeedAfterLedgers(t *testing.T) {
+	table := NewTable()
+	table.Track(TradableId{"EURSEK", 12}, "EUR", "SEK")
+
+	// the ledgers are fetched after the tick, which arrives later
+	table.Clock = func() time.Time { return time.Unix(10, 0) }
+	assert.NoError(t, table.Refresh(ledgersFunc(testLedgers), 1))
+	table.HandlePublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "EURSEK", M: 12, Last: d("11.5"), TickTimestamp: 5000}})
+
+	rate, err := table.Rate("EUR", "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, Rate{"EUR", "SEK", d("11.5"), time.Unix(5, 0).UTC(), SourceFeed}, rate)
+
+	// an older feed rate doesn't replace a newer one
+	table.HandlePublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "EURSEK", M: 12, Last: d("11.4"), TickTimestamp: 4000}})
+	rate, err = table.Rate("EUR", "SEK")
+	assert.NoError(t, err)
+	assert.Equal(t, d("11.5"), rate.Value)
+}
+
+func TestHistory(t *testing.T) {
+	history := NewHistory()
+	history.Set(Rate{"USD", "SEK", d("10"), time.Unix(1000, 0), SourceLedger})
+	history.Set(Rate{"USD", "SEK", d("11"), time.Unix(3000, 0), SourceLedger})
+	history.Set(Rate{"EUR", "SEK", d("12"), time.Unix(2000, 0), SourceLedger})
+
+	converted, err := history.ConvertAt(Amount{d("2"), "USD"}, "SEK", time.Unix(2999, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("20"), "SEK"}, converted.Amount)
+
+	converted, err = history.ConvertAt(Amount{d("2"), "USD"}, "SEK", time.Unix(3000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("22"), "SEK"}, converted.Amount)
+
+	converted, err = history.ConvertAt(Amount{d("20"), "SEK"}, "USD", time.Unix(2000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{d("2"), "USD"}, converted.Amount)
+
+	// before the first rate
+	_, err = history.ConvertAt(Amount{d("2"), "USD"}, "SEK", time.Unix(999, 0))
+	assert.Equal(t, MissingRateError{"USD", "SEK"}, err)
+
+	rate, err := history.RateAt("EUR", "USD", time.Unix(2500, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, SourceCross, rate.Source)
+	assert.Equal(t, d("1.2"), rate.Value)
+	assert.Equal(t, time.Unix(1000, 0), rate.At)
+
+	_, err = history.RateAt("EUR", "USD", time.Unix(1500, 0))
+	assert.Equal(t, MissingRateError{"EUR", "USD"}, err)
+
+	// a rate at the same time replaces the earlier one
+	history.Set(Rate{"USD", "SEK", d("10.5"), time.Unix(1000, 0), SourceLedger})
+	rate, _ = history.RateAt("USD", "SEK", time.Unix(1000, 0))
+	assert.Equal(t, d("10.5"), rate.Value)
+}
@@ -0,0 +1,122 @@
+package fx
+
+import (
+	. "github.com/denro/nordnet/util/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DatedConverter converts at the rate that applied at a point in time, which is what historical trades need
+type DatedConverter interface {
+	ConvertAt(amount Amount, to string, at time.Time) (Converted, error)
+}
+
+// History keeps every rate added for a currency pair, e.g. the daily rates published by Riksbanken, and
+// converts at the latest rate at or before a given time. Like Table it stores rates in both directions
+// and converts pairs without a rate through a currency both have a rate to.
+type History struct {
+	// Sorted by At
+	rates map[[2]string][]Rate
+
+	sync.RWMutex
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// Adds the rate and its inverse, replacing a rate for the pair at the same time. Zero rates and rates
+// between the same currency are ignored.
+func (h *History) Set(rate Rate) {
+	if rate.Value.Sign() <= 0 || rate.From == "" || rate.To == "" || rate.From == rate.To {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if h.rates == nil {
+		h.rates = map[[2]string][]Rate{}
+	}
+	h.insert(rate)
+	h.insert(Rate{rate.To, rate.From, DecimalFromInt(1).Div(rate.Value), rate.At, rate.Source})
+}
+
+// Returns the latest rate between the currencies at or before at. A cross rate through another currency
+// gets the time of the older of its two rates.
+func (h *History) RateAt(from, to string, at time.Time) (Rate, error) {
+	if from == to {
+		return Rate{from, to, DecimalFromInt(1), at, ""}, nil
+	}
+
+	h.RLock()
+	defer h.RUnlock()
+
+	if rate, ok := h.at([2]string{from, to}, at); ok {
+		return rate, nil
+	}
+
+	via := []string{}
+	for pair := range h.rates {
+		if pair[0] == from {
+			via = append(via, pair[1])
+		}
+	}
+	sort.Strings(via)
+
+	for _, currency := range via {
+		second, ok := h.at([2]string{to, currency}, at)
+		if !ok {
+			continue
+		}
+		first, ok := h.at([2]string{from, currency}, at)
+		if !ok {
+			continue
+		}
+
+		rateAt := first.At
+		if second.At.Before(rateAt) {
+			rateAt = second.At
+		}
+		return Rate{from, to, first.Value.Div(second.Value), rateAt, SourceCross}, nil
+	}
+
+	return Rate{}, MissingRateError{from, to}
+}
+
+// History implements the DatedConverter interface
+func (h *History) ConvertAt(amount Amount, to string, at time.Time) (Converted, error) {
+	rate, err := h.RateAt(amount.Currency, to, at)
+	if err != nil {
+		return Converted{}, err
+	}
+	return Converted{Amount{amount.Value.Mul(rate.Value), to}, rate}, nil
+}
+
+// Must be called with the lock held
+func (h *History) insert(rate Rate) {
+	pair := [2]string{rate.From, rate.To}
+	rates := h.rates[pair]
+
+	i := sort.Search(len(rates), func(i int) bool { return !rates[i].At.Before(rate.At) })
+	if i < len(rates) && rates[i].At.Equal(rate.At) {
+		rates[i] = rate
+		return
+	}
+
+	rates = append(rates, Rate{})
+	copy(rates[i+1:], rates[i:])
+	rates[i] = rate
+	h.rates[pair] = rates
+}
+
+// Must be called with the lock held
+func (h *History) at(pair [2]string, at time.Time) (Rate, bool) {
+	rates := h.rates[pair]
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].At.After(at) })
+	if i == 0 {
+		return Rate{}, false
+	}
+	return rates[i-1], true
+}
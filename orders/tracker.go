@@ -0,0 +1,327 @@
+/*
+Keeps track of the orders of an account by combining REST snapshots, order replies and private feed updates
+*/
+package orders
+
+import (
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where an update came from
+type Source string
+
+const (
+	SourceREST  Source = "rest"
+	SourceReply Source = "reply"
+	SourceFeed  Source = "feed"
+)
+
+// A change in the life of an order
+type Transition string
+
+const (
+	Accepted        Transition = "accepted"
+	PartiallyFilled Transition = "partially_filled"
+	Filled          Transition = "filled"
+	Cancelled       Transition = "cancelled"
+	Rejected        Transition = "rejected"
+)
+
+// Emitted when an update moves an order through a transition
+type Event struct {
+	Transition Transition
+	Source     Source
+
+	// The order after the update, and before it (the zero Order for new orders)
+	Order, Previous Order
+}
+
+// An applied update in the history of an order
+type Update struct {
+	Source     Source
+	Order      Order
+	ReceivedAt time.Time
+}
+
+// Implemented by api.APIClient
+type OrderLister interface {
+	AccountOrders(accountno int64, params *api.Params) ([]Order, error)
+}
+
+// Tracker merges the three sources of order state of one account, which can arrive in any order:
+// AccountOrders snapshots, OrderReply from CreateOrder/UpdateOrder/DeleteOrder and orders on the private feed.
+//
+// Updates are ordered by the Modified timestamp, an update older than the current state is ignored and an
+// update that changes nothing isn't recorded again.
+// Replies carry no timestamp, they fill in orders that are not known yet and never undo a newer
+// confirmation of the same action.
+type Tracker struct {
+	Accno  int64
+	Client OrderLister
+
+	// Called for every transition, after the update is applied, from the goroutine applying it
+	OnTransition func(Event)
+
+	// Called with the errors of the periodic reconciliation started by Start
+	OnError func(error)
+
+	// Used for the ReceivedAt of updates, time.Now if nil
+	Clock func() time.Time
+
+	orders  map[int64]Order
+	history map[int64][]Update
+
+	sync.Mutex
+}
+
+func NewTracker(client OrderLister, accno int64) *Tracker {
+	return &Tracker{Accno: accno, Client: client}
+}
+
+// Returns the current state of the order
+func (t *Tracker) Order(orderId int64) (Order, bool) {
+	t.Lock()
+	defer t.Unlock()
+	order, ok := t.orders[orderId]
+	return order, ok
+}
+
+// Returns the applied updates of the order, oldest first
+func (t *Tracker) History(orderId int64) []Update {
+	t.Lock()
+	defer t.Unlock()
+	return append([]Update(nil), t.history[orderId]...)
+}
+
+// Returns all known orders sorted by OrderId
+func (t *Tracker) Orders() []Order {
+	return t.filter(func(Order) bool { return true })
+}
+
+// Returns the orders that can still be traded or changed, sorted by OrderId
+func (t *Tracker) Open() []Order {
+	return t.filter(Order.IsOpen)
+}
+
+// Applies the orders returned by AccountOrders
+func (t *Tracker) ApplySnapshot(orders []Order) {
+	t.apply(SourceREST, orders...)
+}
+
+// Applies an order received on the private feed, orders of other accounts are ignored
+func (t *Tracker) ApplyFeed(order feed.PrivateOrder) {
+	t.apply(SourceFeed, Order(order))
+}
+
+// Applies the order messages of the private feed and ignores the rest, so every message can be passed in
+func (t *Tracker) HandleMsg(msg *feed.PrivateMsg) {
+	if order, ok := msg.Data.(feed.PrivateOrder); ok {
+		t.ApplyFeed(order)
+	}
+}
+
+// Applies the initial orders of the private feed, see feed.PrivateFeed.DispatchState
+func (t *Tracker) ApplyState(state *feed.PrivateState) {
+	orders := make([]Order, len(state.Orders))
+	for i, order := range state.Orders {
+		orders[i] = Order(order)
+	}
+	t.apply(SourceFeed, orders...)
+}
+
+// Applies the reply of CreateOrder, UpdateOrder or DeleteOrder for this account. A nil reply is ignored,
+// so the result of the call can be passed directly.
+func (t *Tracker) ApplyReply(reply *OrderReply) {
+	if reply == nil || reply.OrderId == 0 {
+		return
+	}
+
+	t.Lock()
+	current, known := t.orders[reply.OrderId]
+	if known && !replyApplies(current, reply) {
+		t.Unlock()
+		return
+	}
+
+	next := current
+	if !known {
+		next = Order{Accno: t.Accno, OrderId: reply.OrderId}
+	}
+	if reply.OrderState != "" {
+		next.OrderState = reply.OrderState
+	}
+	if reply.ActionState != "" {
+		next.ActionState = reply.ActionState
+	} else if reply.ResultCode.IsRejected() && !known {
+		next.ActionState = InsertFailed
+	}
+
+	events := t.store(SourceReply, current, next)
+	t.Unlock()
+
+	t.emit(events)
+}
+
+// Fetches the orders of the account, including deleted ones, and applies them
+func (t *Tracker) Reconcile() error {
+	orders, err := t.Client.AccountOrders(t.Accno, &api.Params{"deleted": "true"})
+	if err != nil {
+		return err
+	}
+	t.ApplySnapshot(orders)
+	return nil
+}
+
+// Used by Start for intervals that aren't positive
+const DefaultReconcileInterval = 30 * time.Second
+
+// Reconciles against REST every interval until the returned function is called
+func (t *Tracker) Start(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := t.Reconcile(); err != nil && t.OnError != nil {
+					t.OnError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (t *Tracker) apply(source Source, orders ...Order) {
+	events := []Event{}
+
+	t.Lock()
+	for _, order := range orders {
+		if order.Accno != 0 && order.Accno != t.Accno {
+			continue
+		}
+
+		current, known := t.orders[order.OrderId]
+		if known && order.Modified < current.Modified {
+			continue
+		}
+		events = append(events, t.store(source, current, order)...)
+	}
+	t.Unlock()
+
+	t.emit(events)
+}
+
+// Stores the new state and returns the transitions, must be called with the lock held. An update that
+// changes nothing, e.g. an unchanged order in a repeated snapshot, isn't added to the history.
+func (t *Tracker) store(source Source, current, next Order) []Event {
+	if next == current {
+		return nil
+	}
+	if t.orders == nil {
+		t.orders = map[int64]Order{}
+		t.history = map[int64][]Update{}
+	}
+
+	t.orders[next.OrderId] = next
+	t.history[next.OrderId] = append(t.history[next.OrderId], Update{source, next, t.now()})
+
+	events := []Event{}
+	for _, transition := range transitions(current, next) {
+		events = append(events, Event{transition, source, next, current})
+	}
+	return events
+}
+
+func (t *Tracker) emit(events []Event) {
+	if t.OnTransition == nil {
+		return
+	}
+	for _, event := range events {
+		t.OnTransition(event)
+	}
+}
+
+func (t *Tracker) filter(keep func(Order) bool) []Order {
+	t.Lock()
+	defer t.Unlock()
+
+	res := []Order{}
+	for _, order := range t.orders {
+		if keep(order) {
+			res = append(res, order)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].OrderId < res[j].OrderId })
+	return res
+}
+
+func (t *Tracker) now() time.Time {
+	if t.Clock != nil {
+		return t.Clock()
+	}
+	return time.Now()
+}
+
+// A reply never changes a terminal order, and never replaces a confirmed or failed action with the pending state of the same action
+func replyApplies(current Order, reply *OrderReply) bool {
+	if current.IsTerminal() {
+		return false
+	}
+	return !(reply.ActionState.IsPending() && !current.ActionState.IsPending() && actionKind(reply.ActionState) == actionKind(current.ActionState))
+}
+
+// Returns INS, MOD or DEL
+func actionKind(state ActionState) string {
+	return strings.SplitN(string(state), "_", 2)[0]
+}
+
+// Returns the transitions between the two states, in the order they happened
+func transitions(prev, next Order) (res []Transition) {
+	if next.IsRejected() && prev.ActionState != next.ActionState {
+		res = append(res, Rejected)
+	}
+	if accepted(next) && !accepted(prev) {
+		res = append(res, Accepted)
+	}
+	if next.TradedVolume > prev.TradedVolume && !filled(next) {
+		res = append(res, PartiallyFilled)
+	}
+	if filled(next) && !filled(prev) {
+		res = append(res, Filled)
+	}
+	if cancelled(next) && !cancelled(prev) {
+		res = append(res, Cancelled)
+	}
+	return
+}
+
+func accepted(o Order) bool {
+	return o.OrderState == OrderOnMarket || o.OrderState == OrderDone || o.ActionState == InsertConfirmed || o.TradedVolume > 0
+}
+
+func filled(o Order) bool {
+	return o.OrderState == OrderDone || (o.TradedVolume > 0 && o.TradedVolume >= o.Volume)
+}
+
+func cancelled(o Order) bool {
+	return (o.OrderState == OrderDeleted || o.ActionState == DeleteConfirmed) && !filled(o)
+}
@@ -0,0 +1,170 @@
+package orders
+
+import (
+	"errors"
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type listerFunc func(accountno int64, params *api.Params) ([]Order, error)
+
+func (f listerFunc) AccountOrders(accountno int64, params *api.Params) ([]Order, error) {
+	return f(accountno, params)
+}
+
+func newTestTracker() (*Tracker, *[]Transition) {
+	transitions := &[]Transition{}
+	tracker := NewTracker(nil, 1)
+	tracker.OnTransition = func(e Event) {
+		*transitions = append(*transitions, e.Transition)
+	}
+	return tracker, transitions
+}
+
+func order(id int64, modified Timestamp, state OrderState, action ActionState, volume, traded float64) Order {
+	return Order{
+		Accno:        1,
+		OrderId:      id,
+		Modified:     modified,
+		OrderState:   state,
+		ActionState:  action,
+		Volume:       volume,
+		TradedVolume: traded,
+		OpenVolume:   volume - traded,
+	}
+}
+
+func TestTrackerLifecycle(t *testing.T) {
+	tracker, transitions := newTestTracker()
+
+	tracker.ApplyReply(&OrderReply{OrderId: 10, ResultCode: ResultOK, OrderState: OrderLocal, ActionState: InsertPending})
+	tracker.ApplyFeed(feed.PrivateOrder(order(10, 100, OrderOnMarket, InsertConfirmed, 10, 0)))
+	tracker.ApplyFeed(feed.PrivateOrder(order(10, 200, OrderOnMarket, InsertConfirmed, 10, 4)))
+	tracker.ApplySnapshot([]Order{order(10, 300, OrderDone, InsertConfirmed, 10, 10)})
+
+	assert.Equal(t, []Transition{Accepted, PartiallyFilled, Filled}, *transitions)
+
+	current, ok := tracker.Order(10)
+	assert.True(t, ok)
+	assert.Equal(t, OrderDone, current.OrderState)
+	assert.Empty(t, tracker.Open())
+
+	history := tracker.History(10)
+	assert.Len(t, history, 4)
+	assert.Equal(t, []Source{SourceReply, SourceFeed, SourceFeed, SourceREST},
+		[]Source{history[0].Source, history[1].Source, history[2].Source, history[3].Source})
+}
+
+func TestTrackerOutOfOrder(t *testing.T) {
+	tracker, transitions := newTestTracker()
+
+	// the feed confirms the delete before the reply and an old snapshot arrive
+	tracker.ApplyFeed(feed.PrivateOrder(order(10, 200, OrderDeleted, DeleteConfirmed, 10, 0)))
+	tracker.ApplySnapshot([]Order{order(10, 100, OrderOnMarket, InsertConfirmed, 10, 0)})
+	tracker.ApplyReply(&OrderReply{OrderId: 10, ResultCode: ResultOK, OrderState: OrderOnMarket, ActionState: DeletePending})
+
+	current, _ := tracker.Order(10)
+	assert.Equal(t, OrderDeleted, current.OrderState)
+	assert.Equal(t, DeleteConfirmed, current.ActionState)
+	assert.Equal(t, []Transition{Cancelled}, *transitions)
+	assert.Len(t, tracker.History(10), 1)
+
+	// a pending modify doesn't undo a confirmed one
+	tracker.ApplyFeed(feed.PrivateOrder(order(11, 100, OrderOnMarket, ModifyConfirmed, 10, 0)))
+	tracker.ApplyReply(&OrderReply{OrderId: 11, ResultCode: ResultOK, OrderState: OrderOnMarket, ActionState: ModifyPending})
+	current, _ = tracker.Order(11)
+	assert.Equal(t, ModifyConfirmed, current.ActionState)
+
+	// but a later delete does
+	tracker.ApplyReply(&OrderReply{OrderId: 11, ResultCode: ResultOK, OrderState: OrderOnMarket, ActionState: DeletePending})
+	current, _ = tracker.Order(11)
+	assert.Equal(t, DeletePending, current.ActionState)
+}
+
+func TestTrackerRejected(t *testing.T) {
+	tracker, transitions := newTestTracker()
+
+	tracker.ApplyReply(&OrderReply{OrderId: 12, ResultCode: "NEXT_INVALID_PRICE"})
+	tracker.ApplyReply(nil)
+
+	current, ok := tracker.Order(12)
+	assert.True(t, ok)
+	assert.True(t, current.IsRejected())
+	assert.Equal(t, []Transition{Rejected}, *transitions)
+}
+
+func TestTrackerIgnoresOtherAccounts(t *testing.T) {
+	tracker, transitions := newTestTracker()
+
+	other := order(13, 100, OrderOnMarket, InsertConfirmed, 10, 0)
+	other.Accno = 2
+	tracker.HandleMsg(&feed.PrivateMsg{Type: "order", Data: feed.PrivateOrder(other)})
+	tracker.HandleMsg(&feed.PrivateMsg{Type: "heartbeat", Data: struct{}{}})
+
+	assert.Empty(t, tracker.Orders())
+	assert.Empty(t, *transitions)
+}
+
+func TestTrackerReconcile(t *testing.T) {
+	calls := make(chan *api.Params, 10)
+	tracker, _ := newTestTracker()
+	tracker.Client = listerFunc(func(accountno int64, params *api.Params) ([]Order, error) {
+		assert.EqualValues(t, 1, accountno)
+		calls <- params
+		return []Order{order(14, 100, OrderOnMarket, InsertConfirmed, 10, 0)}, nil
+	})
+
+	assert.NoError(t, tracker.Reconcile())
+	assert.Equal(t, &api.Params{"deleted": "true"}, <-calls)
+	assert.Len(t, tracker.Open(), 1)
+
+	tracker.Client = listerFunc(func(int64, *api.Params) ([]Order, error) {
+		return nil, errors.New("unavailable")
+	})
+	errs := make(chan error, 10)
+	tracker.OnError = func(err error) { errs <- err }
+
+	stop := tracker.Start(time.Millisecond)
+	assert.EqualError(t, <-errs, "unavailable")
+	stop()
+	stop()
+}
+
+func TestTrackerRepeatedSnapshot(t *testing.T) {
+	tracker, transitions := newTestTracker()
+	tracker.Client = listerFunc(func(int64, *api.Params) ([]Order, error) {
+		return []Order{order(15, 100, OrderOnMarket, InsertConfirmed, 10, 0)}, nil
+	})
+
+	assert.NoError(t, tracker.Reconcile())
+	assert.NoError(t, tracker.Reconcile())
+	assert.Len(t, tracker.History(15), 1)
+	assert.Equal(t, []Transition{Accepted}, *transitions)
+}
+
+func TestTrackerStartDefaultInterval(t *testing.T) {
+	tracker, _ := newTestTracker()
+	stop := tracker.Start(0)
+	stop()
+	stop = tracker.Start(-time.Second)
+	stop()
+}
+
+func TestTrackerApplyState(t *testing.T) {
+	tracker, transitions := newTestTracker()
+	ledger := NewTradeLedger(nil, 1)
+	state := &feed.PrivateState{
+		Orders: []feed.PrivateOrder{feed.PrivateOrder(order(15, 100, OrderDone, InsertConfirmed, 10, 10))},
+		Trades: []feed.PrivateTrade{feed.PrivateTrade(trade("a", 15, time.Unix(0, 0), 10))},
+	}
+
+	tracker.ApplyState(state)
+	ledger.ApplyState(state)
+
+	assert.Equal(t, []Transition{Accepted, Filled}, *transitions)
+	assert.Empty(t, ledger.Verify(tracker.Orders()))
+}
@@ -0,0 +1,207 @@
+package orders
+
+import (
+	"fmt"
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Volumes closer than this are considered equal when verifying orders
+const volumeTolerance = 1e-9
+
+// Implemented by api.APIClient
+type TradeLister interface {
+	AccountTrades(accountno int64, params *api.Params) ([]Trade, error)
+}
+
+// An order whose TradedVolume doesn't match the sum of its fills in the ledger
+type Discrepancy struct {
+	OrderId      int64
+	TradedVolume float64
+	FilledVolume float64
+}
+
+// Discrepancy implements the error interface
+func (d Discrepancy) Error() string {
+	return fmt.Sprintf("Order %d has traded volume %v but fills of %v", d.OrderId, d.TradedVolume, d.FilledVolume)
+}
+
+// TradeLedger collects the fills of one account from the private feed and AccountTrades. The two overlap,
+// and the feed misses the trades done while it was disconnected, so trades are deduplicated by TradeId
+// and gaps are filled in with Backfill after a reconnect.
+type TradeLedger struct {
+	Accno  int64
+	Client TradeLister
+
+	// Used to decide how many days Backfill fetches, time.Now if nil
+	Clock func() time.Time
+
+	trades  map[string]Trade
+	byOrder map[int64][]Trade
+	latest  Timestamp
+
+	sync.Mutex
+}
+
+func NewTradeLedger(client TradeLister, accno int64) *TradeLedger {
+	return &TradeLedger{Accno: accno, Client: client}
+}
+
+// Adds the trades that are not in the ledger yet and returns them, trades of other accounts are ignored
+func (l *TradeLedger) Add(trades ...Trade) (added []Trade) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.trades == nil {
+		l.trades = map[string]Trade{}
+		l.byOrder = map[int64][]Trade{}
+	}
+
+	for _, trade := range trades {
+		if trade.Accno != 0 && trade.Accno != l.Accno {
+			continue
+		}
+		if _, ok := l.trades[trade.TradeId]; ok {
+			continue
+		}
+
+		l.trades[trade.TradeId] = trade
+		l.byOrder[trade.OrderId] = append(l.byOrder[trade.OrderId], trade)
+		if trade.Tradetime > l.latest {
+			l.latest = trade.Tradetime
+		}
+		added = append(added, trade)
+	}
+
+	return
+}
+
+// Adds a trade received on the private feed, reports if it was new
+func (l *TradeLedger) ApplyFeed(trade feed.PrivateTrade) bool {
+	return len(l.Add(Trade(trade))) > 0
+}
+
+// Adds the trade messages of the private feed and ignores the rest, so every message can be passed in
+func (l *TradeLedger) HandleMsg(msg *feed.PrivateMsg) {
+	if trade, ok := msg.Data.(feed.PrivateTrade); ok {
+		l.ApplyFeed(trade)
+	}
+}
+
+// Adds the initial trades of the private feed, see feed.PrivateFeed.DispatchState
+func (l *TradeLedger) ApplyState(state *feed.PrivateState) {
+	trades := make([]Trade, len(state.Trades))
+	for i, trade := range state.Trades {
+		trades[i] = Trade(trade)
+	}
+	l.Add(trades...)
+}
+
+// Fetches the trades done since the given time with AccountTrades and adds the missing ones, which are returned.
+// A zero since uses the time of the latest trade in the ledger, which is what is needed after a reconnect.
+// On an empty ledger a zero since only fetches today's trades, pass the start of the wanted history instead.
+func (l *TradeLedger) Backfill(since time.Time) ([]Trade, error) {
+	if since.IsZero() {
+		l.Lock()
+		since = l.latest.Time()
+		l.Unlock()
+	}
+
+	trades, err := l.Client.AccountTrades(l.Accno, &api.Params{"days": strconv.Itoa(l.daysSince(since))})
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Add(trades...), nil
+}
+
+// Returns all trades ordered by trade time
+func (l *TradeLedger) Trades() []Trade {
+	l.Lock()
+	res := make([]Trade, 0, len(l.trades))
+	for _, trade := range l.trades {
+		res = append(res, trade)
+	}
+	l.Unlock()
+
+	sortTrades(res)
+	return res
+}
+
+// Returns the fills of the order ordered by trade time
+func (l *TradeLedger) OrderTrades(orderId int64) []Trade {
+	l.Lock()
+	res := append([]Trade{}, l.byOrder[orderId]...)
+	l.Unlock()
+
+	sortTrades(res)
+	return res
+}
+
+// Returns the summed volume of the fills of the order
+func (l *TradeLedger) FilledVolume(orderId int64) (volume float64) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, trade := range l.byOrder[orderId] {
+		volume += trade.Volume
+	}
+	return
+}
+
+// Checks that the TradedVolume of every order equals the sum of its fills, e.g. with the orders of a Tracker.
+// Orders of other accounts are skipped. Fills done before the earliest backfilled day are not in the ledger,
+// so the orders should be restricted to that period.
+func (l *TradeLedger) Verify(orders []Order) (discrepancies []Discrepancy) {
+	for _, order := range orders {
+		if order.Accno != 0 && order.Accno != l.Accno {
+			continue
+		}
+
+		filled := l.FilledVolume(order.OrderId)
+		if math.Abs(filled-order.TradedVolume) > volumeTolerance {
+			discrepancies = append(discrepancies, Discrepancy{order.OrderId, order.TradedVolume, filled})
+		}
+	}
+	return
+}
+
+// Orders the trades by trade time, and by id for trades done at the same time
+func sortTrades(trades []Trade) {
+	sort.Slice(trades, func(i, j int) bool {
+		if trades[i].Tradetime != trades[j].Tradetime {
+			return trades[i].Tradetime < trades[j].Tradetime
+		}
+		return trades[i].TradeId < trades[j].TradeId
+	})
+}
+
+// The days parameter of AccountTrades counts calendar days back from today in Swedish time, 0 is today only
+func (l *TradeLedger) daysSince(since time.Time) int {
+	if since.IsZero() {
+		return 0
+	}
+
+	now := time.Now()
+	if l.Clock != nil {
+		now = l.Clock()
+	}
+
+	loc := CountryLocation("SE")
+	days := math.Round(startOfDay(now, loc).Sub(startOfDay(since, loc)).Hours() / 24)
+	if days < 0 {
+		return 0
+	}
+	return int(days)
+}
+
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
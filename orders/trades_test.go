@@ -0,0 +1,82 @@
+package orders
+
+import (
+	"github.com/denro/nordnet/api"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type tradeListerFunc func(accountno int64, params *api.Params) ([]Trade, error)
+
+func (f tradeListerFunc) AccountTrades(accountno int64, params *api.Params) ([]Trade, error) {
+	return f(accountno, params)
+}
+
+func trade(id string, orderId int64, tradetime time.Time, volume float64) Trade {
+	return Trade{Accno: 1, OrderId: orderId, TradeId: id, Tradetime: TimestampOf(tradetime), Volume: volume, Side: Buy}
+}
+
+func TestTradeLedgerDeduplicates(t *testing.T) {
+	ledger := NewTradeLedger(nil, 1)
+	day := time.Date(2015, 1, 29, 10, 0, 0, 0, time.UTC)
+
+	assert.True(t, ledger.ApplyFeed(feed.PrivateTrade(trade("b", 10, day.Add(time.Minute), 6))))
+	assert.False(t, ledger.ApplyFeed(feed.PrivateTrade(trade("b", 10, day.Add(time.Minute), 6))))
+
+	other := trade("c", 11, day, 1)
+	other.Accno = 2
+	ledger.HandleMsg(&feed.PrivateMsg{Type: "trade", Data: feed.PrivateTrade(other)})
+
+	added := ledger.Add(trade("a", 10, day, 4), trade("b", 10, day.Add(time.Minute), 6))
+	assert.Len(t, added, 1)
+	assert.Equal(t, "a", added[0].TradeId)
+
+	trades := ledger.Trades()
+	assert.Len(t, trades, 2)
+	assert.Equal(t, "a", trades[0].TradeId)
+	assert.Equal(t, 10.0, ledger.FilledVolume(10))
+	assert.Empty(t, ledger.OrderTrades(11))
+}
+
+func TestTradeLedgerBackfill(t *testing.T) {
+	now := time.Date(2015, 3, 31, 8, 0, 0, 0, time.UTC)
+	params := make(chan *api.Params, 10)
+
+	ledger := NewTradeLedger(tradeListerFunc(func(accountno int64, p *api.Params) ([]Trade, error) {
+		assert.EqualValues(t, 1, accountno)
+		params <- p
+		return []Trade{trade("a", 10, now.AddDate(0, 0, -2), 4), trade("b", 10, now.Add(-time.Hour), 6)}, nil
+	}), 1)
+	ledger.Clock = func() time.Time { return now }
+
+	// nothing seen yet, only today
+	added, err := ledger.Backfill(time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, added, 2)
+	assert.Equal(t, &api.Params{"days": "0"}, <-params)
+
+	// a disconnect over the weekend
+	added, err = ledger.Backfill(time.Date(2015, 3, 27, 22, 30, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Empty(t, added)
+	assert.Equal(t, &api.Params{"days": "4"}, <-params)
+}
+
+func TestTradeLedgerVerify(t *testing.T) {
+	ledger := NewTradeLedger(nil, 1)
+	day := time.Date(2015, 1, 29, 10, 0, 0, 0, time.UTC)
+	ledger.Add(trade("a", 10, day, 0.1), trade("b", 10, day, 0.2), trade("c", 11, day, 5))
+
+	discrepancies := ledger.Verify([]Order{
+		{Accno: 1, OrderId: 10, TradedVolume: 0.3},
+		{Accno: 1, OrderId: 11, TradedVolume: 10},
+		{Accno: 1, OrderId: 12, TradedVolume: 0},
+		{Accno: 2, OrderId: 13, TradedVolume: 1},
+	})
+
+	assert.Equal(t, []Discrepancy{{OrderId: 11, TradedVolume: 10, FilledVolume: 5}}, discrepancies)
+	assert.EqualError(t, discrepancies[0], "Order 11 has traded volume 10 but fills of 5")
+}
@@ -0,0 +1,331 @@
+package performance
+
+import (
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"math"
+	"sort"
+	"time"
+)
+
+const year = 365.25 * 24 * time.Hour
+
+// The performance of an account, or of all accounts consolidated, over the sampled period. Returns are
+// fractions, e.g. 0.05 for 5%.
+type Metrics struct {
+	// Zero for the consolidated metrics
+	Accno int64
+
+	From, To time.Time
+	Start    Amount
+	End      Amount
+
+	// Net deposits during the period
+	Flows Amount
+
+	// Time weighted return, unaffected by deposits and withdrawals
+	Return float64
+
+	// Return compounded to a year, the same as Return for periods shorter than a year
+	AnnualizedReturn float64
+
+	// Annualized internal rate of return, weighting the periods by the capital. NaN if it can't be solved.
+	MoneyWeightedReturn float64
+
+	// Largest fall from a peak of the time weighted return, positive
+	MaxDrawdown float64
+
+	// Annualized standard deviation of the returns between samples
+	Volatility float64
+
+	// Excess return over the risk free rate per unit of volatility. For periods shorter than a year the
+	// return, the risk free rate and the volatility are all taken over the period.
+	Sharpe float64
+
+	// Return of the benchmark over the same period and the return in excess of it, zero without a benchmark
+	BenchmarkReturn float64
+	Excess          float64
+}
+
+// The metrics of every account, sorted by account number, and of all accounts together
+type Result struct {
+	Accounts []Metrics
+	Total    Metrics
+}
+
+// Analyzer computes the metrics of stored samples
+type Analyzer struct {
+	// The src:identifier of the benchmark samples to compare with, optional
+	Benchmark string
+
+	// Annual risk free rate for the Sharpe ratio
+	RiskFree float64
+
+	// Currency of the consolidated metrics, the currency of the first account if empty
+	Base string
+
+	// Converts accounts in other currencies than Base at the current rates, required if there are any
+	Rates fx.Converter
+}
+
+func NewAnalyzer(benchmark string) *Analyzer {
+	return &Analyzer{Benchmark: benchmark}
+}
+
+type point struct {
+	at    time.Time
+	value float64
+
+	// Sum of the flows since the previous point, included in value
+	flow float64
+
+	// The same flows at the times the money moved, for the money weighted return
+	flows []flow
+}
+
+type flow struct {
+	at     time.Time
+	amount float64
+}
+
+// Computes the metrics of the capital and flow samples per account and consolidated
+func (a *Analyzer) Analyze(samples []Sample) (*Result, error) {
+	sorted := make([]Sample, len(samples))
+	copy(sorted, samples)
+	// a flow at the same time as a capital sample is included in its value, whatever order they were stored in
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].At.Equal(sorted[j].At) {
+			return sorted[i].At.Before(sorted[j].At)
+		}
+		return sorted[i].Kind == KindFlow && sorted[j].Kind != KindFlow
+	})
+
+	series := map[int64][]point{}
+	currencies := map[int64]string{}
+	pending := map[int64][]flow{}
+	benchmark := []point{}
+	accnos := []int64{}
+
+	for _, sample := range sorted {
+		switch sample.Kind {
+		case KindCapital:
+			if _, ok := series[sample.Accno]; !ok {
+				accnos = append(accnos, sample.Accno)
+				currencies[sample.Accno] = sample.Value.Currency
+				// flows before the first sample are part of its value
+				pending[sample.Accno] = nil
+			}
+			p := point{at: sample.At, value: sample.Value.Value.Float64(), flows: pending[sample.Accno]}
+			for _, f := range p.flows {
+				p.flow += f.amount
+			}
+			series[sample.Accno] = append(series[sample.Accno], p)
+			pending[sample.Accno] = nil
+		case KindFlow:
+			pending[sample.Accno] = append(pending[sample.Accno], flow{sample.At, sample.Value.Value.Float64()})
+		case KindBenchmark:
+			if sample.Benchmark == a.Benchmark {
+				benchmark = append(benchmark, point{at: sample.At, value: sample.Value.Value.Float64()})
+			}
+		}
+	}
+	sort.Slice(accnos, func(i, j int) bool { return accnos[i] < accnos[j] })
+
+	base := a.Base
+	if base == "" && len(accnos) > 0 {
+		base = currencies[accnos[0]]
+	}
+
+	res := &Result{Accounts: []Metrics{}}
+	rates := map[int64]float64{}
+	for _, accno := range accnos {
+		m := a.metrics(series[accno], benchmark, currencies[accno])
+		m.Accno = accno
+		res.Accounts = append(res.Accounts, m)
+
+		rate, err := a.rate(currencies[accno], base)
+		if err != nil {
+			return nil, err
+		}
+		rates[accno] = rate
+	}
+
+	res.Total = a.metrics(consolidate(series, rates, accnos), benchmark, base)
+	return res, nil
+}
+
+// Multiplier from the currency to the base currency
+func (a *Analyzer) rate(currency, base string) (float64, error) {
+	if currency == base || currency == "" {
+		return 1, nil
+	}
+	if a.Rates == nil {
+		return 0, CurrencyMismatchError{base, currency}
+	}
+	converted, err := a.Rates.Convert(Amount{DecimalFromInt(1), currency}, base)
+	if err != nil {
+		return 0, err
+	}
+	return converted.Rate.Value.Float64(), nil
+}
+
+// Sums the latest values of the accounts at every sample time. An account joining later is a flow.
+func consolidate(series map[int64][]point, rates map[int64]float64, accnos []int64) []point {
+	times := []time.Time{}
+	seen := map[time.Time]bool{}
+	for _, accno := range accnos {
+		for _, p := range series[accno] {
+			if !seen[p.at] {
+				seen[p.at] = true
+				times = append(times, p.at)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	next := map[int64]int{}
+	latest := map[int64]float64{}
+	res := []point{}
+	for i, at := range times {
+		total := point{at: at}
+		for _, accno := range accnos {
+			points := series[accno]
+			for next[accno] < len(points) && !points[next[accno]].at.After(at) {
+				p := points[next[accno]]
+				if next[accno] == 0 && i > 0 {
+					total.flow += p.value * rates[accno]
+					total.flows = append(total.flows, flow{p.at, p.value * rates[accno]})
+				} else {
+					total.flow += p.flow * rates[accno]
+					for _, f := range p.flows {
+						total.flows = append(total.flows, flow{f.at, f.amount * rates[accno]})
+					}
+				}
+				latest[accno] = p.value * rates[accno]
+				next[accno]++
+			}
+			total.value += latest[accno]
+		}
+		res = append(res, total)
+	}
+	return res
+}
+
+func (a *Analyzer) metrics(points []point, benchmark []point, currency string) Metrics {
+	m := Metrics{Start: Amount{Currency: currency}, End: Amount{Currency: currency}, Flows: Amount{Currency: currency}}
+	if len(points) == 0 {
+		return m
+	}
+
+	first, last := points[0], points[len(points)-1]
+	m.From, m.To = first.at, last.at
+	m.Start.Value = DecimalFromFloat(first.value)
+	m.End.Value = DecimalFromFloat(last.value)
+
+	returns := []float64{}
+	index, peak, flows := 1.0, 1.0, 0.0
+	for i := 1; i < len(points); i++ {
+		flows += points[i].flow
+		if points[i-1].value <= 0 {
+			continue
+		}
+		r := (points[i].value-points[i].flow)/points[i-1].value - 1
+		returns = append(returns, r)
+
+		index *= 1 + r
+		peak = math.Max(peak, index)
+		m.MaxDrawdown = math.Max(m.MaxDrawdown, 1-index/peak)
+	}
+	m.Flows.Value = DecimalFromFloat(flows)
+	m.Return = index - 1
+
+	years := float64(m.To.Sub(m.From)) / float64(year)
+	if years > 0 {
+		m.AnnualizedReturn = m.Return
+		if years >= 1 {
+			m.AnnualizedReturn = math.Pow(index, 1/years) - 1
+		}
+		m.MoneyWeightedReturn = irr(points)
+		if len(returns) > 1 {
+			m.Volatility = stddev(returns) * math.Sqrt(float64(len(returns))/years)
+		}
+	}
+	if m.Volatility > 0 {
+		if years >= 1 {
+			m.Sharpe = (m.AnnualizedReturn - a.RiskFree) / m.Volatility
+		} else {
+			riskFree := math.Pow(1+a.RiskFree, years) - 1
+			m.Sharpe = (m.Return - riskFree) / (m.Volatility * math.Sqrt(years))
+		}
+	}
+
+	if len(benchmark) > 0 {
+		if start := valueAt(benchmark, m.From); start > 0 {
+			m.BenchmarkReturn = valueAt(benchmark, m.To)/start - 1
+			m.Excess = m.Return - m.BenchmarkReturn
+		}
+	}
+	return m
+}
+
+// The annual rate at which the starting value and the flows grow to the ending value, found by bisection.
+// Every flow is discounted from the time it was made.
+func irr(points []point) float64 {
+	first, last := points[0], points[len(points)-1]
+	npv := func(rate float64) float64 {
+		discount := func(at time.Time) float64 {
+			return math.Pow(1+rate, -float64(at.Sub(first.at))/float64(year))
+		}
+		res := -first.value
+		for _, p := range points[1:] {
+			for _, f := range p.flows {
+				res -= f.amount * discount(f.at)
+			}
+		}
+		return res + last.value*discount(last.at)
+	}
+
+	low, high := -0.9999, 1.0
+	for npv(low)*npv(high) > 0 {
+		if high > 1e6 {
+			return math.NaN()
+		}
+		high *= 2
+	}
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if npv(low)*npv(mid) <= 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// Sample standard deviation
+func stddev(values []float64) float64 {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// The last value at or before the time, or the first value if there is none
+func valueAt(points []point, at time.Time) float64 {
+	res := points[0].value
+	for _, p := range points {
+		if p.at.After(at) {
+			break
+		}
+		res = p.value
+	}
+	return res
+}
@@ -0,0 +1,248 @@
+package performance
+
+import (
+	"errors"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeFetcher struct {
+	capital map[int64]string
+}
+
+func (f fakeFetcher) Accounts() ([]Account, error) {
+	return []Account{{Accno: 1}, {Accno: 2}}, nil
+}
+
+func (f fakeFetcher) Account(accountno int64) (*AccountInfo, error) {
+	capital, ok := f.capital[accountno]
+	if !ok {
+		return nil, errors.New("unknown account")
+	}
+	return &AccountInfo{OwnCapital: Amount{MustDecimal(capital), "SEK"}}, nil
+}
+
+func TestStoreAndRecorder(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "samples.jsonl"))
+	samples, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+
+	at := time.Date(2023, 1, 2, 17, 0, 0, 0, time.UTC)
+	recorder := NewRecorder(store, fakeFetcher{map[int64]string{1: "100", 2: "200.5"}})
+	recorder.Clock = func() time.Time { return at }
+
+	assert.NoError(t, recorder.RecordAccounts())
+	assert.NoError(t, recorder.RecordFlow(1, Amount{MustDecimal("50"), "SEK"}, at.Add(-time.Hour)))
+
+	omx := IndicatorId{Src: "SIX", Identifier: "OMXS30"}
+	recorder.Track(omx)
+	recorder.HandlePublic(&feed.PublicMsg{Type: "indicator", Data: feed.PublicIndicator{I: "OMXS30", M: "SIX", Last: MustDecimal("2200.5")}})
+	recorder.HandlePublic(&feed.PublicMsg{Type: "indicator", Data: feed.PublicIndicator{I: "OMXS60", M: "SIX", Last: MustDecimal("1")}})
+	recorder.HandlePublic(&feed.PublicMsg{Type: "heartbeat", Data: struct{}{}})
+
+	samples, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Sample{
+		{Kind: KindFlow, At: at.Add(-time.Hour), Accno: 1, Value: Amount{MustDecimal("50"), "SEK"}},
+		{Kind: KindCapital, At: at, Accno: 1, Value: Amount{MustDecimal("100"), "SEK"}},
+		{Kind: KindCapital, At: at, Accno: 2, Value: Amount{MustDecimal("200.5"), "SEK"}},
+		{Kind: KindBenchmark, At: at, Benchmark: "SIX:OMXS30", Value: Amount{Value: MustDecimal("2200.5")}},
+	}, samples)
+
+	recorder.Client = fakeFetcher{}
+	assert.EqualError(t, recorder.RecordAccounts(), "unknown account")
+}
+
+func TestRecorderInterval(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "samples.jsonl"))
+	recorder := NewRecorder(store, fakeFetcher{})
+	recorder.Track(IndicatorId{Src: "SIX", Identifier: "OMXS30"})
+
+	at := time.Date(2023, 1, 2, 9, 0, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{0, 30 * time.Second, time.Minute, 90 * time.Second} {
+		recorder.HandlePublic(&feed.PublicMsg{Type: "indicator", Data: feed.PublicIndicator{
+			I: "OMXS30", M: "SIX", Last: DecimalFromInt(int64(2200 + i)), TickTimestamp: TimestampOf(at.Add(offset)),
+		}})
+	}
+
+	samples, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Sample{
+		{Kind: KindBenchmark, At: at, Benchmark: "SIX:OMXS30", Value: Amount{Value: DecimalFromInt(2200)}},
+		{Kind: KindBenchmark, At: at.Add(time.Minute), Benchmark: "SIX:OMXS30", Value: Amount{Value: DecimalFromInt(2202)}},
+	}, samples)
+}
+
+type benchmarkFetcher struct {
+	fakeFetcher
+}
+
+func (f benchmarkFetcher) LookupIndicators(indicators ...IndicatorId) ([]Indicator, error) {
+	res := []Indicator{}
+	for _, id := range indicators {
+		if id.Identifier == "OMXS30" {
+			res = append(res, Indicator{Src: id.Src, Identifier: id.Identifier, InstrumentId: 18})
+		}
+	}
+	return res, nil
+}
+
+func (f benchmarkFetcher) Instruments(ids ...int64) ([]Instrument, error) {
+	return []Instrument{{InstrumentId: 18, Tradables: []Tradable{{TradableId: TradableId{"OMXS30", 3}}}}}, nil
+}
+
+func (f benchmarkFetcher) TradableIntraday(ids ...TradableId) ([]IntradayGraph, error) {
+	return []IntradayGraph{{TradableId: ids[0], Ticks: []IntradayTick{
+		{Timestamp: 2000, Last: MustDecimal("2201")},
+		{Timestamp: 1000, Last: MustDecimal("2200")},
+	}}}, nil
+}
+
+func TestRecordBenchmarks(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "samples.jsonl"))
+	recorder := NewRecorder(store, fakeFetcher{})
+	recorder.Track(IndicatorId{Src: "SIX", Identifier: "OMXS30"})
+	assert.Equal(t, ErrNoBenchmarkFetcher, recorder.RecordBenchmarks())
+
+	recorder.Client = benchmarkFetcher{}
+	recorder.Track(IndicatorId{Src: "SIX", Identifier: "UNKNOWN"})
+	assert.NoError(t, recorder.RecordBenchmarks())
+
+	samples, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Sample{
+		{Kind: KindBenchmark, At: time.Unix(2, 0).UTC(), Benchmark: "SIX:OMXS30", Value: Amount{Value: MustDecimal("2201")}},
+	}, samples)
+}
+
+func capital(accno int64, at time.Time, value string, currency string) Sample {
+	return Sample{Kind: KindCapital, At: at, Accno: accno, Value: Amount{MustDecimal(value), currency}}
+}
+
+func TestAnalyze(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1, t2 := t0.Add(year/2), t0.Add(year)
+
+	samples := []Sample{
+		capital(1, t2, "150", "SEK"),
+		capital(1, t0, "100", "SEK"),
+		capital(1, t1, "110", "SEK"),
+		{Kind: KindFlow, At: t1.Add(time.Hour), Accno: 1, Value: Amount{MustDecimal("50"), "SEK"}},
+		capital(2, t1, "200", "SEK"),
+		capital(2, t2, "220", "SEK"),
+		{Kind: KindBenchmark, At: t0, Benchmark: "SIX:OMXS30", Value: Amount{Value: MustDecimal("1000")}},
+		{Kind: KindBenchmark, At: t2, Benchmark: "SIX:OMXS30", Value: Amount{Value: MustDecimal("1100")}},
+	}
+
+	analyzer := NewAnalyzer("SIX:OMXS30")
+	analyzer.RiskFree = 0.01
+	res, err := analyzer.Analyze(samples)
+	assert.NoError(t, err)
+	assert.Len(t, res.Accounts, 2)
+
+	m := res.Accounts[0]
+	assert.EqualValues(t, 1, m.Accno)
+	assert.Equal(t, t0, m.From)
+	assert.Equal(t, t2, m.To)
+	assert.Equal(t, Amount{MustDecimal("50"), "SEK"}, m.Flows)
+	assert.InDelta(t, 0, m.Return, 1e-9)
+	assert.InDelta(t, 0, m.MoneyWeightedReturn, 1e-9)
+	assert.InDelta(t, 1-1/1.1, m.MaxDrawdown, 1e-9)
+	assert.InDelta(t, 0.190909, m.Volatility, 1e-6)
+	assert.InDelta(t, -0.01/0.190909, m.Sharpe, 1e-4)
+	assert.InDelta(t, 0.1, m.BenchmarkReturn, 1e-9)
+	assert.InDelta(t, -0.1, m.Excess, 1e-9)
+
+	// the second account joining is a flow of the consolidated series
+	total := res.Total
+	assert.Equal(t, Amount{MustDecimal("370"), "SEK"}, total.End)
+	assert.Equal(t, Amount{MustDecimal("250"), "SEK"}, total.Flows)
+	assert.InDelta(t, 1.1*(320.0/310.0)-1, total.Return, 1e-9)
+	assert.InDelta(t, 0, total.MaxDrawdown, 1e-9)
+}
+
+func TestAnalyzeFlows(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1, t2 := t0.Add(year/4), t0.Add(year)
+
+	// the deposit is made a quarter into the year, between the capital samples
+	samples := []Sample{
+		capital(1, t0, "100", "SEK"),
+		{Kind: KindFlow, At: t1, Accno: 1, Value: Amount{MustDecimal("100"), "SEK"}},
+		capital(1, t2, "220", "SEK"),
+	}
+	res, err := NewAnalyzer("").Analyze(samples)
+	assert.NoError(t, err)
+
+	r := res.Accounts[0].MoneyWeightedReturn
+	assert.InDelta(t, 220, 100*(1+r)+100*math.Pow(1+r, 0.75), 1e-6)
+	assert.InDelta(t, 0.115, r, 1e-3)
+	assert.InDelta(t, r, res.Total.MoneyWeightedReturn, 1e-9)
+
+	// a flow at the time of a capital sample is included in it, even if stored after it
+	samples = []Sample{
+		capital(1, t0, "100", "SEK"),
+		capital(1, t1, "150", "SEK"),
+		{Kind: KindFlow, At: t1, Accno: 1, Value: Amount{MustDecimal("50"), "SEK"}},
+		capital(1, t2, "150", "SEK"),
+	}
+	res, err = NewAnalyzer("").Analyze(samples)
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{MustDecimal("50"), "SEK"}, res.Accounts[0].Flows)
+	assert.InDelta(t, 0, res.Accounts[0].Return, 1e-9)
+	assert.InDelta(t, 0, res.Accounts[0].MoneyWeightedReturn, 1e-9)
+}
+
+func TestAnalyzeShortPeriod(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		capital(1, t0, "100", "SEK"),
+		capital(1, t0.Add(year/8), "105", "SEK"),
+		capital(1, t0.Add(year/4), "110", "SEK"),
+	}
+
+	analyzer := NewAnalyzer("")
+	analyzer.RiskFree = 0.01
+	res, err := analyzer.Analyze(samples)
+	assert.NoError(t, err)
+
+	m := res.Accounts[0]
+	assert.InDelta(t, 0.1, m.Return, 1e-9)
+	assert.InDelta(t, 0.1, m.AnnualizedReturn, 1e-9)
+	// the sharpe ratio is taken over the quarter
+	periodVolatility := stddev([]float64{0.05, 110.0/105 - 1}) * math.Sqrt(2)
+	assert.InDelta(t, periodVolatility*2, m.Volatility, 1e-9)
+	assert.InDelta(t, (0.1-(math.Pow(1.01, 0.25)-1))/periodVolatility, m.Sharpe, 1e-9)
+}
+
+func TestAnalyzeCurrencies(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		capital(1, t0, "1000", "SEK"),
+		capital(2, t0, "100", "EUR"),
+		capital(1, t0.Add(year), "1100", "SEK"),
+		capital(2, t0.Add(year), "100", "EUR"),
+	}
+
+	_, err := NewAnalyzer("").Analyze(samples)
+	assert.Equal(t, CurrencyMismatchError{"SEK", "EUR"}, err)
+
+	rates := fx.NewTable()
+	rates.Set(fx.Rate{From: "EUR", To: "SEK", Value: MustDecimal("10")})
+	analyzer := NewAnalyzer("")
+	analyzer.Rates = rates
+
+	res, err := analyzer.Analyze(samples)
+	assert.NoError(t, err)
+	assert.Equal(t, Amount{MustDecimal("2100"), "SEK"}, res.Total.End)
+	assert.InDelta(t, 0.05, res.Total.Return, 1e-9)
+	assert.InDelta(t, 0.05, res.Total.MoneyWeightedReturn, 1e-9)
+	assert.Zero(t, res.Total.BenchmarkReturn)
+}
@@ -0,0 +1,309 @@
+/*
+Records snapshots of the own capital of accounts and of benchmark indicators to a local file, and computes
+returns, drawdown, volatility and Sharpe ratio from them without a live session
+*/
+package performance
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/denro/nordnet/feed"
+	. "github.com/denro/nordnet/util/models"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of samples
+const (
+	// The own capital of an account
+	KindCapital = "capital"
+
+	// A deposit to an account, or a withdrawal if negative. A capital sample at the same time includes it.
+	KindFlow = "flow"
+
+	// The value of a benchmark indicator
+	KindBenchmark = "benchmark"
+)
+
+// A stored observation
+type Sample struct {
+	Kind  string    `json:"kind"`
+	At    time.Time `json:"at"`
+	Accno int64     `json:"accno,omitempty"`
+
+	// The indicator, as src:identifier, of benchmark samples
+	Benchmark string `json:"benchmark,omitempty"`
+
+	Value Amount `json:"value"`
+}
+
+// Store keeps samples as JSON Lines in a file, appending to it
+type Store struct {
+	Path string
+
+	sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{Path: path}
+}
+
+// Appends the samples to the file, creating it if needed
+func (s *Store) Append(samples ...Sample) error {
+	s.Lock()
+	defer s.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, sample := range samples {
+		if err := enc.Encode(sample); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Loads all samples sorted by time, none if the file doesn't exist
+func (s *Store) Load() ([]Sample, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	res := []Sample{}
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, err
+		}
+		res = append(res, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].At.Before(res[j].At) })
+	return res, nil
+}
+
+// Implemented by api.APIClient
+type AccountInfoFetcher interface {
+	Accounts() ([]Account, error)
+	Account(accountno int64) (*AccountInfo, error)
+}
+
+// Implemented by api.APIClient. RecordBenchmarks needs the Client of the Recorder to implement it.
+type BenchmarkFetcher interface {
+	LookupIndicators(indicators ...IndicatorId) ([]Indicator, error)
+	Instruments(ids ...int64) ([]Instrument, error)
+	TradableIntraday(ids ...TradableId) ([]IntradayGraph, error)
+}
+
+// Returned by RecordBenchmarks when the client can't fetch indicators
+var ErrNoBenchmarkFetcher = errors.New("The client doesn't implement BenchmarkFetcher")
+
+// Default minimum time between stored samples of a benchmark
+const DefaultBenchmarkInterval = time.Minute
+
+// Recorder appends samples of the own capital of the accounts and of the tracked benchmarks to a store
+type Recorder struct {
+	Store  *Store
+	Client AccountInfoFetcher
+
+	// Called with the errors of storing benchmark samples from HandlePublic
+	OnError func(error)
+
+	// Used for the time of samples, time.Now if nil
+	Clock func() time.Time
+
+	// Minimum time between stored samples of a benchmark, ticks in between are dropped. Every tick is
+	// stored if zero.
+	Interval time.Duration
+
+	benchmarks map[IndicatorId]bool
+	written    map[IndicatorId]time.Time
+
+	sync.Mutex
+}
+
+func NewRecorder(store *Store, client AccountInfoFetcher) *Recorder {
+	return &Recorder{Store: store, Client: client, Interval: DefaultBenchmarkInterval}
+}
+
+// Fetches the own capital of every account and stores it, all with the same time
+func (r *Recorder) RecordAccounts() error {
+	accounts, err := r.Client.Accounts()
+	if err != nil {
+		return err
+	}
+
+	at := r.now()
+	samples := []Sample{}
+	for _, account := range accounts {
+		info, err := r.Client.Account(account.Accno)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, Sample{Kind: KindCapital, At: at, Accno: account.Accno, Value: info.OwnCapital})
+	}
+	return r.Store.Append(samples...)
+}
+
+// Fetches the last values of the tracked indicators over REST and stores them, without a feed session. The
+// value is the last tick of today's graph of the tradable of the indicator, indicators without ticks yet
+// are skipped.
+func (r *Recorder) RecordBenchmarks() error {
+	fetcher, ok := r.Client.(BenchmarkFetcher)
+	if !ok {
+		return ErrNoBenchmarkFetcher
+	}
+
+	r.Lock()
+	ids := []IndicatorId{}
+	for id := range r.benchmarks {
+		ids = append(ids, id)
+	}
+	r.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	indicators, err := fetcher.LookupIndicators(ids...)
+	if err != nil {
+		return err
+	}
+	byInstrument := map[int64]IndicatorId{}
+	instrumentIds := []int64{}
+	for _, indicator := range indicators {
+		if indicator.InstrumentId != 0 {
+			byInstrument[indicator.InstrumentId] = IndicatorId{Src: indicator.Src, Identifier: indicator.Identifier}
+			instrumentIds = append(instrumentIds, indicator.InstrumentId)
+		}
+	}
+	if len(instrumentIds) == 0 {
+		return nil
+	}
+
+	instruments, err := fetcher.Instruments(instrumentIds...)
+	if err != nil {
+		return err
+	}
+	byTradable := map[TradableId]IndicatorId{}
+	tradables := []TradableId{}
+	for _, instrument := range instruments {
+		id, ok := byInstrument[instrument.InstrumentId]
+		if !ok || len(instrument.Tradables) == 0 {
+			continue
+		}
+		tradable := instrument.Tradables[0].TradableId
+		byTradable[tradable] = id
+		tradables = append(tradables, tradable)
+	}
+	if len(tradables) == 0 {
+		return nil
+	}
+
+	graphs, err := fetcher.TradableIntraday(tradables...)
+	if err != nil {
+		return err
+	}
+	samples := []Sample{}
+	for _, graph := range graphs {
+		id, ok := byTradable[graph.TradableId]
+		if !ok || len(graph.Ticks) == 0 {
+			continue
+		}
+		last := graph.Ticks[0]
+		for _, tick := range graph.Ticks[1:] {
+			if tick.Timestamp >= last.Timestamp {
+				last = tick
+			}
+		}
+
+		at := last.Timestamp.Time()
+		if at.IsZero() {
+			at = r.now()
+		}
+		samples = append(samples, Sample{Kind: KindBenchmark, At: at, Benchmark: id.String(), Value: Amount{Value: last.Last}})
+	}
+	return r.Store.Append(samples...)
+}
+
+// Stores a deposit to the account, or a withdrawal if negative. Trades don't change the own capital
+// and aren't flows.
+func (r *Recorder) RecordFlow(accno int64, amount Amount, at time.Time) error {
+	return r.Store.Append(Sample{Kind: KindFlow, At: at, Accno: accno, Value: amount})
+}
+
+// Stores the values of the indicator from the feed, subscribe to it with feed.NewIndicatorArgs, or from
+// RecordBenchmarks
+func (r *Recorder) Track(id IndicatorId) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.benchmarks == nil {
+		r.benchmarks = map[IndicatorId]bool{}
+	}
+	r.benchmarks[id] = true
+}
+
+// Stores the last value of tracked indicators at most once per Interval and ignores the rest, so every
+// message can be passed in
+func (r *Recorder) HandlePublic(msg *feed.PublicMsg) {
+	indicator, ok := msg.Data.(feed.PublicIndicator)
+	if !ok || indicator.Last.IsZero() {
+		return
+	}
+
+	at := indicator.TickTimestamp.Time()
+	if at.IsZero() {
+		at = r.now()
+	}
+
+	id := indicator.IndicatorId()
+	r.Lock()
+	if !r.benchmarks[id] {
+		r.Unlock()
+		return
+	}
+	if last, ok := r.written[id]; ok && at.Sub(last) < r.Interval {
+		r.Unlock()
+		return
+	}
+	if r.written == nil {
+		r.written = map[IndicatorId]time.Time{}
+	}
+	r.written[id] = at
+	r.Unlock()
+
+	sample := Sample{Kind: KindBenchmark, At: at, Benchmark: indicator.IndicatorId().String(), Value: Amount{Value: indicator.Last}}
+	if err := r.Store.Append(sample); err != nil && r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+func (r *Recorder) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
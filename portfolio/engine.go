@@ -0,0 +1,472 @@
+/*
+Values the positions of one or more accounts live, using prices from the public feed and fills from the private feed
+*/
+package portfolio
+
+import (
+	"errors"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	NotLoadedError = errors.New("Trades can't be applied before the positions are loaded")
+)
+
+// Implemented by api.APIClient
+type PositionLister interface {
+	AccountPositions(accountno int64) ([]Position, error)
+}
+
+// Implemented by api.APIClient. When the client of an Engine implements it, Load takes the account currency
+// from the account, otherwise it is taken from the positions and unknown for accounts without any.
+type AccountGetter interface {
+	Account(accountno int64) (*AccountInfo, error)
+}
+
+// Implemented by feed.PublicFeed
+type Subscriber interface {
+	Subscribe(args interface{}) error
+}
+
+// The value of one position, amounts are in the account currency except Price
+type PositionValue struct {
+	Accno      int64
+	Tradable   TradableId
+	Instrument Instrument
+	Qty        float64
+
+	// Latest price in the instrument currency
+	Price Amount
+
+	MarketValue   Amount
+	UnrealizedPnL Amount
+	DayPnL        Amount
+
+	// False when no exchange rate to the account currency is known, the amounts are zero and left out of the totals
+	Priced bool
+}
+
+// The positions of an account and their totals in the account currency
+type AccountValue struct {
+	Accno         int64
+	MarketValue   Amount
+	UnrealizedPnL Amount
+	DayPnL        Amount
+	Positions     []PositionValue
+}
+
+// The value of all accounts at a point in time
+type Valuation struct {
+	At       time.Time
+	Accounts []AccountValue
+}
+
+// Engine loads the positions of the accounts with AccountPositions, subscribes to prices for the held
+// tradables and keeps the positions up to date with the fills from the private feed.
+//
+// Pass the public and private feed messages to HandlePublic and HandlePrivate. Fills that happened before
+// Load are already part of the positions, so only live fills should be passed, see feed.PrivateFeed.DispatchState.
+type Engine struct {
+	Client PositionLister
+	Feed   Subscriber
+	Accnos []int64
+
+	// Used for positions, loaded or created by fills, whose exchange rate to the account currency can't be derived from the positions, optional
+	Rates fx.Converter
+
+	// Called with the new valuation after every change, from the goroutine making it
+	OnUpdate func(Valuation)
+
+	// Used for Valuation.At, time.Now if nil
+	Clock func() time.Time
+
+	holdings   map[holdingKey]*holding
+	aliases    map[holdingKey]holdingKey
+	currencies map[int64]string
+	subscribed map[TradableId]bool
+	trades     map[string]bool
+
+	sync.Mutex
+}
+
+type holdingKey struct {
+	accno    int64
+	tradable TradableId
+}
+
+// A position in numbers, prices are per unit in the instrument currency
+type holding struct {
+	instrument Instrument
+	currency   string
+	qty        Decimal
+	multiplier Decimal
+	acqPrice   Decimal
+	price      Decimal
+
+	// Value at the morning price plus the net amount bought today, in the instrument currency
+	dayCost Decimal
+
+	// Account currency per unit of the instrument currency, zero if unknown
+	fxRate Decimal
+}
+
+func NewEngine(client PositionLister, subscriber Subscriber, accnos ...int64) *Engine {
+	return &Engine{Client: client, Feed: subscriber, Accnos: accnos}
+}
+
+// Loads the positions of all accounts, replacing the current ones, and subscribes to their prices
+func (e *Engine) Load() error {
+	loaded := map[int64][]Position{}
+	currencies := map[int64]string{}
+	getter, _ := e.Client.(AccountGetter)
+	for _, accno := range e.Accnos {
+		positions, err := e.Client.AccountPositions(accno)
+		if err != nil {
+			return err
+		}
+		loaded[accno] = positions
+
+		if getter != nil {
+			info, err := getter.Account(accno)
+			if err != nil {
+				return err
+			}
+			currencies[accno] = info.AccountCurrency
+		}
+	}
+
+	e.Lock()
+	e.holdings = map[holdingKey]*holding{}
+	e.aliases = map[holdingKey]holdingKey{}
+	e.currencies = map[int64]string{}
+	e.trades = map[string]bool{}
+	if e.subscribed == nil {
+		e.subscribed = map[TradableId]bool{}
+	}
+
+	for accno, positions := range loaded {
+		for _, position := range positions {
+			e.addPosition(accno, position)
+		}
+	}
+	for accno, currency := range currencies {
+		if currency != "" {
+			e.currencies[accno] = currency
+		}
+	}
+	for key, h := range e.holdings {
+		if h.fxRate.IsZero() {
+			h.fxRate = e.knownRate(key.accno, h.currency)
+		}
+	}
+	subscribe := e.unsubscribed()
+	e.Unlock()
+
+	if err := e.subscribe(subscribe); err != nil {
+		return err
+	}
+
+	e.emit()
+	return nil
+}
+
+// Updates the prices from price messages and ignores the rest, so every message can be passed in
+func (e *Engine) HandlePublic(msg *feed.PublicMsg) {
+	if price, ok := msg.Data.(feed.PublicPrice); ok {
+		last := price.Last
+		if last.IsZero() {
+			last = price.Close
+		}
+		e.ApplyPrice(price.TradableId(), last)
+	}
+}
+
+// Applies the fills from trade messages and ignores the rest, so every message can be passed in
+func (e *Engine) HandlePrivate(msg *feed.PrivateMsg) error {
+	if trade, ok := msg.Data.(feed.PrivateTrade); ok {
+		return e.ApplyTrade(Trade(trade))
+	}
+	return nil
+}
+
+// Sets the price of the tradable, in the instrument currency
+func (e *Engine) ApplyPrice(id TradableId, price Decimal) {
+	if price.IsZero() {
+		return
+	}
+
+	e.Lock()
+	changed := false
+	for key, h := range e.holdings {
+		if key.tradable == id && h.price != price {
+			h.price = price
+			changed = true
+		}
+	}
+	e.Unlock()
+
+	if changed {
+		e.emit()
+	}
+}
+
+// Applies a fill to the quantity and acquisition price of the position, creating it if needed.
+// Trades of other accounts and trades already applied are ignored. Before Load NotLoadedError is
+// returned, as it isn't known yet whether the positions will include the trade.
+func (e *Engine) ApplyTrade(trade Trade) error {
+	e.Lock()
+	if e.holdings == nil {
+		e.Unlock()
+		return NotLoadedError
+	}
+	if e.trades[trade.TradeId] || !e.tracks(trade.Accno) {
+		e.Unlock()
+		return nil
+	}
+	e.trades[trade.TradeId] = true
+
+	key, ok := e.aliases[holdingKey{trade.Accno, trade.Tradable}]
+	if !ok {
+		key = holdingKey{trade.Accno, trade.Tradable}
+		e.holdings[key] = &holding{
+			instrument: Instrument{Currency: trade.Price.Currency, Tradables: []Tradable{{TradableId: trade.Tradable}}},
+			currency:   trade.Price.Currency,
+			multiplier: DecimalFromInt(1),
+			fxRate:     e.knownRate(trade.Accno, trade.Price.Currency),
+		}
+		e.aliases[key] = key
+	}
+	e.holdings[key].fill(trade)
+
+	subscribe := e.unsubscribed()
+	e.Unlock()
+
+	err := e.subscribe(subscribe)
+	e.emit()
+	return err
+}
+
+// Returns the current valuation
+func (e *Engine) Valuation() Valuation {
+	e.Lock()
+	defer e.Unlock()
+	return e.valuation()
+}
+
+func (e *Engine) valuation() Valuation {
+	byAccount := map[int64]*AccountValue{}
+	for key, h := range e.holdings {
+		account, ok := byAccount[key.accno]
+		if !ok {
+			currency := e.currencies[key.accno]
+			account = &AccountValue{
+				Accno:         key.accno,
+				MarketValue:   Amount{Currency: currency},
+				UnrealizedPnL: Amount{Currency: currency},
+				DayPnL:        Amount{Currency: currency},
+			}
+			byAccount[key.accno] = account
+		}
+
+		value := h.value(key, e.currencies[key.accno])
+		account.Positions = append(account.Positions, value)
+		if value.Priced {
+			account.MarketValue.Value = account.MarketValue.Value.Add(value.MarketValue.Value)
+			account.UnrealizedPnL.Value = account.UnrealizedPnL.Value.Add(value.UnrealizedPnL.Value)
+			account.DayPnL.Value = account.DayPnL.Value.Add(value.DayPnL.Value)
+		}
+	}
+
+	res := Valuation{At: e.now(), Accounts: []AccountValue{}}
+	for _, account := range byAccount {
+		sort.Slice(account.Positions, func(i, j int) bool {
+			return account.Positions[i].Tradable.String() < account.Positions[j].Tradable.String()
+		})
+		res.Accounts = append(res.Accounts, *account)
+	}
+	sort.Slice(res.Accounts, func(i, j int) bool { return res.Accounts[i].Accno < res.Accounts[j].Accno })
+
+	return res
+}
+
+// Must be called with the lock held
+func (e *Engine) addPosition(accno int64, position Position) {
+	if position.Accno != 0 {
+		accno = position.Accno
+	}
+	if position.MarketValueAcc.Currency != "" {
+		e.currencies[accno] = position.MarketValueAcc.Currency
+	}
+
+	qty := DecimalFromFloat(position.Qty)
+	multiplier := DecimalFromFloat(position.Instrument.Multiplier)
+	if multiplier.IsZero() {
+		multiplier = DecimalFromInt(1)
+	}
+
+	h := &holding{
+		instrument: position.Instrument,
+		currency:   position.MarketValue.Currency,
+		qty:        qty,
+		multiplier: multiplier,
+		acqPrice:   position.AcqPrice.Value,
+		fxRate:     rate(position.MarketValueAcc, position.MarketValue, position.AcqPriceAcc, position.AcqPrice),
+	}
+	if h.currency == "" {
+		h.currency = position.Instrument.Currency
+	}
+	if units := qty.Mul(multiplier); !units.IsZero() {
+		h.price = position.MarketValue.Value.Div(units)
+	}
+	if !position.MorningPrice.Value.IsZero() {
+		h.dayCost = qty.Mul(position.MorningPrice.Value).Mul(multiplier)
+	} else {
+		h.dayCost = position.MarketValue.Value
+	}
+
+	key := holdingKey{accno, priceTradable(position.Instrument)}
+	e.holdings[key] = h
+	e.aliases[key] = key
+	for _, id := range position.Instrument.TradableIds() {
+		e.aliases[holdingKey{accno, id}] = key
+	}
+}
+
+// Returns the tradables that need a price subscription, must be called with the lock held
+func (e *Engine) unsubscribed() (res []TradableId) {
+	for key := range e.holdings {
+		if key.tradable != (TradableId{}) && !e.subscribed[key.tradable] {
+			e.subscribed[key.tradable] = true
+			res = append(res, key.tradable)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].String() < res[j].String() })
+	return
+}
+
+func (e *Engine) subscribe(ids []TradableId) error {
+	if e.Feed == nil {
+		return nil
+	}
+	for _, id := range ids {
+		if err := e.Feed.Subscribe(feed.NewPriceArgs(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The exchange rate of another position in the same currency, must be called with the lock held
+func (e *Engine) knownRate(accno int64, currency string) Decimal {
+	if currency == e.currencies[accno] {
+		return DecimalFromInt(1)
+	}
+	for key, h := range e.holdings {
+		if key.accno == accno && h.currency == currency && !h.fxRate.IsZero() {
+			return h.fxRate
+		}
+	}
+	if e.Rates != nil {
+		if converted, err := e.Rates.Convert(Amount{DecimalFromInt(1), currency}, e.currencies[accno]); err == nil {
+			return converted.Amount.Value
+		}
+	}
+	return Decimal{}
+}
+
+func (e *Engine) tracks(accno int64) bool {
+	for _, a := range e.Accnos {
+		if a == accno {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) emit() {
+	if e.OnUpdate == nil {
+		return
+	}
+	e.OnUpdate(e.Valuation())
+}
+
+func (e *Engine) now() time.Time {
+	if e.Clock != nil {
+		return e.Clock()
+	}
+	return time.Now()
+}
+
+func (h *holding) fill(trade Trade) {
+	volume := DecimalFromFloat(trade.Volume)
+	if trade.Side == Sell {
+		volume = volume.Neg()
+	}
+	price := trade.Price.Value
+
+	if trade.Side == Buy {
+		if total := h.qty.Add(volume); !total.IsZero() {
+			h.acqPrice = h.qty.Mul(h.acqPrice).Add(volume.Mul(price)).Div(total)
+		}
+	}
+	h.qty = h.qty.Add(volume)
+	h.dayCost = h.dayCost.Add(volume.Mul(price).Mul(h.multiplier))
+	if h.price.IsZero() {
+		h.price = price
+	}
+}
+
+func (h *holding) value(key holdingKey, currency string) PositionValue {
+	value := PositionValue{
+		Accno:         key.accno,
+		Tradable:      key.tradable,
+		Instrument:    h.instrument,
+		Qty:           h.qty.Float64(),
+		Price:         Amount{h.price, h.currency},
+		MarketValue:   Amount{Currency: currency},
+		UnrealizedPnL: Amount{Currency: currency},
+		DayPnL:        Amount{Currency: currency},
+		Priced:        !h.fxRate.IsZero(),
+	}
+	if !value.Priced {
+		return value
+	}
+
+	marketValue := h.qty.Mul(h.price).Mul(h.multiplier)
+	value.MarketValue.Value = marketValue.Mul(h.fxRate)
+	value.UnrealizedPnL.Value = marketValue.Sub(h.qty.Mul(h.acqPrice).Mul(h.multiplier)).Mul(h.fxRate)
+	value.DayPnL.Value = marketValue.Sub(h.dayCost).Mul(h.fxRate)
+	return value
+}
+
+// Derives the exchange rate from the account and instrument currency amounts of a position
+func rate(amounts ...Amount) Decimal {
+	for i := 0; i+1 < len(amounts); i += 2 {
+		acc, local := amounts[i], amounts[i+1]
+		if acc.Currency != "" && acc.Currency == local.Currency {
+			return DecimalFromInt(1)
+		}
+		if !acc.Value.IsZero() && !local.Value.IsZero() {
+			return acc.Value.Div(local.Value)
+		}
+	}
+	return Decimal{}
+}
+
+// The tradable to get prices for, the first listing that isn't on the smart order market
+func priceTradable(instrument Instrument) TradableId {
+	for _, tradable := range instrument.Tradables {
+		if !tradable.IsSmartOrder() {
+			return tradable.TradableId
+		}
+	}
+	if len(instrument.Tradables) > 0 {
+		return instrument.Tradables[0].TradableId
+	}
+	return TradableId{}
+}
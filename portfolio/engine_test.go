@@ -0,0 +1,221 @@
+package portfolio
+
+import (
+	"errors"
+	"github.com/denro/nordnet/feed"
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type positionsFunc func(accountno int64) ([]Position, error)
+
+func (f positionsFunc) AccountPositions(accountno int64) ([]Position, error) {
+	return f(accountno)
+}
+
+// Also implements AccountGetter, with the account currency from the map
+type accountsClient struct {
+	positionsFunc
+	currencies map[int64]string
+}
+
+func (c accountsClient) Account(accountno int64) (*AccountInfo, error) {
+	return &AccountInfo{AccountCurrency: c.currencies[accountno]}, nil
+}
+
+type recordingSubscriber struct {
+	args []interface{}
+}
+
+func (s *recordingSubscriber) Subscribe(args interface{}) error {
+	s.args = append(s.args, args)
+	return nil
+}
+
+func d(s string) Decimal {
+	return MustDecimal(s)
+}
+
+var (
+	eric = Instrument{InstrumentId: 1, Currency: "SEK", Symbol: "ERIC B", Tradables: []Tradable{
+		{TradableId: TradableId{"101", 11}},
+		{TradableId: TradableId{"101", 80}},
+	}}
+	aapl = Instrument{InstrumentId: 2, Currency: "USD", Symbol: "AAPL", Tradables: []Tradable{
+		{TradableId: TradableId{"AAPL", 19}},
+	}}
+)
+
+func testPositions(accountno int64) ([]Position, error) {
+	switch accountno {
+	case 1:
+		return []Position{
+			{
+				Accno: 1, Instrument: eric, Qty: 100,
+				MarketValueAcc: Amount{d("10000"), "SEK"}, MarketValue: Amount{d("10000"), "SEK"},
+				AcqPriceAcc: Amount{d("90"), "SEK"}, AcqPrice: Amount{d("90"), "SEK"},
+				MorningPrice: Amount{d("95"), "SEK"},
+			},
+			{
+				Accno: 1, Instrument: aapl, Qty: 10,
+				MarketValueAcc: Amount{d("15000"), "SEK"}, MarketValue: Amount{d("1500"), "USD"},
+				AcqPriceAcc: Amount{d("1200"), "SEK"}, AcqPrice: Amount{d("120"), "USD"},
+				MorningPrice: Amount{d("150"), "USD"},
+			},
+		}, nil
+	case 2:
+		return []Position{}, nil
+	}
+	return nil, errors.New("unknown account")
+}
+
+func TestEngineLoad(t *testing.T) {
+	subscriber := &recordingSubscriber{}
+	engine := NewEngine(positionsFunc(testPositions), subscriber, 1, 2)
+
+	updates := 0
+	engine.OnUpdate = func(Valuation) { updates++ }
+
+	assert.NoError(t, engine.Load())
+	assert.Equal(t, 1, updates)
+	assert.Equal(t, []interface{}{
+		feed.NewPriceArgs(TradableId{"101", 11}),
+		feed.NewPriceArgs(TradableId{"AAPL", 19}),
+	}, subscriber.args)
+
+	valuation := engine.Valuation()
+	assert.Len(t, valuation.Accounts, 1)
+
+	account := valuation.Accounts[0]
+	assert.Equal(t, Amount{d("25000"), "SEK"}, account.MarketValue)
+	assert.Equal(t, Amount{d("4000"), "SEK"}, account.UnrealizedPnL)
+	assert.Equal(t, Amount{d("500"), "SEK"}, account.DayPnL)
+
+	assert.Equal(t, Amount{d("100"), "SEK"}, account.Positions[0].Price)
+	assert.Equal(t, Amount{d("150"), "USD"}, account.Positions[1].Price)
+
+	// loading again doesn't subscribe twice
+	assert.NoError(t, engine.Load())
+	assert.Len(t, subscriber.args, 2)
+
+	engine.Accnos = append(engine.Accnos, 3)
+	assert.EqualError(t, engine.Load(), "unknown account")
+}
+
+func TestEnginePrices(t *testing.T) {
+	engine := NewEngine(positionsFunc(testPositions), nil, 1)
+	assert.NoError(t, engine.Load())
+
+	var last Valuation
+	engine.OnUpdate = func(v Valuation) { last = v }
+
+	engine.HandlePublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "101", M: 11, Last: d("101.5")}})
+	engine.HandlePublic(&feed.PublicMsg{Type: "price", Data: feed.PublicPrice{I: "AAPL", M: 19, Close: d("149")}})
+	engine.HandlePublic(&feed.PublicMsg{Type: "heartbeat", Data: struct{}{}})
+
+	account := last.Accounts[0]
+	assert.Equal(t, Amount{d("10150"), "SEK"}, account.Positions[0].MarketValue)
+	assert.Equal(t, Amount{d("650"), "SEK"}, account.Positions[0].DayPnL)
+	assert.Equal(t, Amount{d("14900"), "SEK"}, account.Positions[1].MarketValue)
+	assert.Equal(t, Amount{d("-100"), "SEK"}, account.Positions[1].DayPnL)
+	assert.Equal(t, Amount{d("25050"), "SEK"}, account.MarketValue)
+}
+
+func TestEngineFills(t *testing.T) {
+	subscriber := &recordingSubscriber{}
+	engine := NewEngine(positionsFunc(testPositions), subscriber, 1)
+	assert.NoError(t, engine.Load())
+
+	buy := Trade{Accno: 1, TradeId: "a", Tradable: TradableId{"101", 80}, Side: Buy, Volume: 100, Price: Amount{d("110"), "SEK"}}
+	assert.NoError(t, engine.HandlePrivate(&feed.PrivateMsg{Type: "trade", Data: feed.PrivateTrade(buy)}))
+	assert.NoError(t, engine.ApplyTrade(buy))
+
+	position := engine.Valuation().Accounts[0].Positions[0]
+	assert.Equal(t, 200.0, position.Qty)
+	assert.Equal(t, Amount{d("20000"), "SEK"}, position.MarketValue)
+	assert.Equal(t, Amount{d("0"), "SEK"}, position.UnrealizedPnL)
+	assert.Equal(t, Amount{d("-500"), "SEK"}, position.DayPnL)
+
+	sell := Trade{Accno: 1, TradeId: "b", Tradable: TradableId{"101", 11}, Side: Sell, Volume: 50, Price: Amount{d("100"), "SEK"}}
+	assert.NoError(t, engine.ApplyTrade(sell))
+	position = engine.Valuation().Accounts[0].Positions[0]
+	assert.Equal(t, 150.0, position.Qty)
+	assert.Equal(t, Amount{d("-500"), "SEK"}, position.DayPnL)
+
+	// a new instrument in a currency without a known rate isn't priced
+	other := Trade{Accno: 1, TradeId: "c", Tradable: TradableId{"XYZ", 99}, Side: Buy, Volume: 1, Price: Amount{d("10"), "EUR"}}
+	assert.NoError(t, engine.ApplyTrade(other))
+	assert.Len(t, subscriber.args, 3)
+
+	account := engine.Valuation().Accounts[0]
+	assert.Len(t, account.Positions, 3)
+	assert.False(t, account.Positions[2].Priced)
+	assert.Equal(t, Amount{d("10"), "EUR"}, account.Positions[2].Price)
+
+	// other accounts are ignored
+	assert.NoError(t, engine.ApplyTrade(Trade{Accno: 2, TradeId: "d", Tradable: TradableId{"101", 11}, Side: Buy, Volume: 1}))
+	assert.Len(t, engine.Valuation().Accounts, 1)
+}
+
+func TestEngineNotLoaded(t *testing.T) {
+	engine := NewEngine(positionsFunc(testPositions), nil, 1)
+	trade := Trade{Accno: 1, TradeId: "a", Tradable: TradableId{"101", 11}, Side: Buy, Volume: 1, Price: Amount{d("100"), "SEK"}}
+	assert.Equal(t, NotLoadedError, engine.ApplyTrade(trade))
+	assert.Equal(t, NotLoadedError, engine.HandlePrivate(&feed.PrivateMsg{Type: "trade", Data: feed.PrivateTrade(trade)}))
+
+	// the trade wasn't marked as applied
+	assert.NoError(t, engine.Load())
+	assert.NoError(t, engine.ApplyTrade(trade))
+	assert.Equal(t, 101.0, engine.Valuation().Accounts[0].Positions[0].Qty)
+}
+
+func TestEngineAccountCurrency(t *testing.T) {
+	// account 2 has no positions, its currency comes from the account
+	client := accountsClient{positionsFunc(testPositions), map[int64]string{1: "SEK", 2: "SEK"}}
+	engine := NewEngine(client, nil, 2)
+	assert.NoError(t, engine.Load())
+
+	trade := Trade{Accno: 2, TradeId: "a", Tradable: TradableId{"101", 11}, Side: Buy, Volume: 10, Price: Amount{d("100"), "SEK"}}
+	assert.NoError(t, engine.ApplyTrade(trade))
+
+	account := engine.Valuation().Accounts[0]
+	assert.True(t, account.Positions[0].Priced)
+	assert.Equal(t, Amount{d("1000"), "SEK"}, account.MarketValue)
+}
+
+func TestEngineRates(t *testing.T) {
+	rates := fx.NewTable()
+	rates.Set(fx.Rate{From: "EUR", To: "SEK", Value: d("11"), Source: fx.SourceFeed})
+
+	engine := NewEngine(positionsFunc(testPositions), nil, 1)
+	engine.Rates = rates
+	assert.NoError(t, engine.Load())
+
+	trade := Trade{Accno: 1, TradeId: "a", Tradable: TradableId{"XYZ", 99}, Side: Buy, Volume: 2, Price: Amount{d("10"), "EUR"}}
+	assert.NoError(t, engine.ApplyTrade(trade))
+
+	position := engine.Valuation().Accounts[0].Positions[2]
+	assert.True(t, position.Priced)
+	assert.Equal(t, Amount{d("220"), "SEK"}, position.MarketValue)
+
+	// a loaded position without account currency amounts gets its rate from the converter too
+	engine.Client = positionsFunc(func(accountno int64) ([]Position, error) {
+		return []Position{
+			{
+				Accno: 1, Instrument: eric, Qty: 10,
+				MarketValueAcc: Amount{d("1000"), "SEK"}, MarketValue: Amount{d("1000"), "SEK"},
+			},
+			{
+				Accno: 1, Instrument: Instrument{Currency: "EUR", Tradables: []Tradable{{TradableId: TradableId{"SAP", 21}}}}, Qty: 1,
+				MarketValue: Amount{d("100"), "EUR"},
+			},
+		}, nil
+	})
+	assert.NoError(t, engine.Load())
+
+	position = engine.Valuation().Accounts[0].Positions[1]
+	assert.True(t, position.Priced)
+	assert.Equal(t, Amount{d("1100"), "SEK"}, position.MarketValue)
+}
@@ -0,0 +1,247 @@
+package portfolio
+
+import (
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Implemented by api.APIClient
+type AccountFetcher interface {
+	PositionLister
+	Accounts() ([]Account, error)
+	Account(accountno int64) (*AccountInfo, error)
+	AccountLedgers(accountno int64) ([]LedgerInformation, error)
+}
+
+// Everything fetched for one account
+type AccountSnapshot struct {
+	Account   Account
+	Info      AccountInfo
+	Ledgers   []LedgerInformation
+	Positions []Position
+
+	// Sum of the market values of the positions, in the account currency
+	MarketValue Amount
+}
+
+// An instrument held in one or more accounts
+type Holding struct {
+	Instrument Instrument
+	Accnos     []int64
+	Qty        float64
+
+	// In the instrument currency and in the base currency
+	MarketValue     Amount
+	BaseMarketValue Amount
+}
+
+// The consolidated view of all accounts
+type Snapshot struct {
+	At   time.Time
+	Base string
+
+	Accounts []AccountSnapshot
+	Holdings []Holding
+
+	// Cash, position market values and their sum per currency, sorted by currency
+	Cash        []Amount
+	MarketValue []Amount
+	Totals      []Amount
+
+	// The sum of Totals in the base currency
+	Total Amount
+
+	// Currencies without an exchange rate to the base currency, they are left out of Total and BaseMarketValue
+	MissingRates []string
+}
+
+// Consolidator takes snapshots of all accounts of a fetcher
+type Consolidator struct {
+	Fetcher AccountFetcher
+	Base    string
+
+	// Converts to the base currency, the exchange rates of the ledgers if nil
+	Rates fx.Converter
+
+	// Used for Snapshot.At, time.Now if nil
+	Clock func() time.Time
+}
+
+func NewConsolidator(fetcher AccountFetcher, base string) *Consolidator {
+	return &Consolidator{Fetcher: fetcher, Base: base}
+}
+
+// Fetches the info, ledgers and positions of all accounts concurrently and consolidates them, converting
+// to the base currency with the exchange rates of the ledgers.
+func Consolidate(fetcher AccountFetcher, base string) (*Snapshot, error) {
+	return NewConsolidator(fetcher, base).Snapshot()
+}
+
+// Like Consolidate but converts to the base currency with the converter, or the rates of the ledgers if nil
+func ConsolidateWith(fetcher AccountFetcher, base string, converter fx.Converter) (*Snapshot, error) {
+	c := NewConsolidator(fetcher, base)
+	c.Rates = converter
+	return c.Snapshot()
+}
+
+// Fetches the info, ledgers and positions of all accounts concurrently and consolidates them
+func (c *Consolidator) Snapshot() (*Snapshot, error) {
+	fetcher, converter := c.Fetcher, c.Rates
+	accounts, err := fetcher.Accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]AccountSnapshot, len(accounts))
+	errs := make([]error, len(accounts)*3)
+
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		snapshots[i].Account = account
+		s, accno := &snapshots[i], account.Accno
+
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			var info *AccountInfo
+			if info, errs[i*3] = fetcher.Account(accno); info != nil {
+				s.Info = *info
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			s.Ledgers, errs[i*3+1] = fetcher.AccountLedgers(accno)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			s.Positions, errs[i*3+2] = fetcher.AccountPositions(accno)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if converter == nil {
+		table := fx.NewTable()
+		for _, snapshot := range snapshots {
+			table.AddLedgers(snapshot.Ledgers...)
+		}
+		converter = table
+	}
+
+	return consolidate(snapshots, c.Base, converter, c.now()), nil
+}
+
+func (c *Consolidator) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+func consolidate(accounts []AccountSnapshot, base string, converter fx.Converter, at time.Time) *Snapshot {
+	cash := map[string]Decimal{}
+	marketValue := map[string]Decimal{}
+	holdings := map[int64]*Holding{}
+	order := []int64{}
+	missing := map[string]bool{}
+
+	for _, account := range accounts {
+		for _, info := range account.Ledgers {
+			for _, ledger := range info.Ledgers {
+				cash[ledger.Currency] = cash[ledger.Currency].Add(ledger.AccountSum.Value)
+			}
+		}
+	}
+
+	for i, account := range accounts {
+		accounts[i].MarketValue = Amount{Currency: account.Info.AccountCurrency}
+
+		for _, position := range account.Positions {
+			accounts[i].MarketValue.Value = accounts[i].MarketValue.Value.Add(position.MarketValueAcc.Value)
+			if accounts[i].MarketValue.Currency == "" {
+				accounts[i].MarketValue.Currency = position.MarketValueAcc.Currency
+			}
+
+			local := position.MarketValue
+			marketValue[local.Currency] = marketValue[local.Currency].Add(local.Value)
+
+			h, ok := holdings[position.Instrument.InstrumentId]
+			if !ok {
+				h = &Holding{
+					Instrument:      position.Instrument,
+					MarketValue:     Amount{Currency: local.Currency},
+					BaseMarketValue: Amount{Currency: base},
+				}
+				holdings[position.Instrument.InstrumentId] = h
+				order = append(order, position.Instrument.InstrumentId)
+			}
+			h.Accnos = append(h.Accnos, account.Account.Accno)
+			h.Qty += position.Qty
+			h.MarketValue.Value = h.MarketValue.Value.Add(local.Value)
+			if converted, ok := convert(converter, local, base); ok {
+				h.BaseMarketValue.Value = h.BaseMarketValue.Value.Add(converted)
+			} else {
+				missing[local.Currency] = true
+			}
+		}
+	}
+
+	res := &Snapshot{At: at, Base: base, Accounts: accounts, Holdings: []Holding{}, Total: Amount{Currency: base}}
+
+	totals := map[string]Decimal{}
+	for currency, value := range cash {
+		res.Cash = append(res.Cash, Amount{value, currency})
+		totals[currency] = totals[currency].Add(value)
+	}
+	for currency, value := range marketValue {
+		res.MarketValue = append(res.MarketValue, Amount{value, currency})
+		totals[currency] = totals[currency].Add(value)
+	}
+	for currency, value := range totals {
+		total := Amount{value, currency}
+		res.Totals = append(res.Totals, total)
+		if converted, ok := convert(converter, total, base); ok {
+			res.Total.Value = res.Total.Value.Add(converted)
+		} else {
+			missing[currency] = true
+		}
+	}
+	sortAmounts(res.Cash)
+	sortAmounts(res.MarketValue)
+	sortAmounts(res.Totals)
+
+	for _, id := range order {
+		res.Holdings = append(res.Holdings, *holdings[id])
+	}
+	sort.SliceStable(res.Holdings, func(i, j int) bool {
+		return res.Holdings[i].BaseMarketValue.Value.Cmp(res.Holdings[j].BaseMarketValue.Value) > 0
+	})
+
+	for currency := range missing {
+		res.MissingRates = append(res.MissingRates, currency)
+	}
+	sort.Strings(res.MissingRates)
+
+	return res
+}
+
+func sortAmounts(amounts []Amount) {
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i].Currency < amounts[j].Currency })
+}
+
+// Zero amounts need no rate
+func convert(converter fx.Converter, amount Amount, to string) (Decimal, bool) {
+	if amount.Value.IsZero() {
+		return Decimal{}, true
+	}
+	converted, err := converter.Convert(amount, to)
+	return converted.Amount.Value, err == nil
+}
@@ -0,0 +1,96 @@
+package portfolio
+
+import (
+	"errors"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeFetcher struct {
+	positionsFunc
+	failLedgers bool
+}
+
+func (f fakeFetcher) Accounts() ([]Account, error) {
+	return []Account{{Accno: 1}, {Accno: 2}}, nil
+}
+
+func (f fakeFetcher) Account(accountno int64) (*AccountInfo, error) {
+	return &AccountInfo{AccountCurrency: "SEK"}, nil
+}
+
+func (f fakeFetcher) AccountLedgers(accountno int64) ([]LedgerInformation, error) {
+	if f.failLedgers {
+		return nil, errors.New("ledgers unavailable")
+	}
+	switch accountno {
+	case 1:
+		return []LedgerInformation{{Ledgers: []Ledger{
+			{Currency: "SEK", AccountSum: Amount{d("1000"), "SEK"}, ExchangeRate: Amount{d("1"), "SEK"}},
+			{Currency: "USD", AccountSum: Amount{d("100"), "USD"}, ExchangeRate: Amount{d("10"), "SEK"}},
+		}}}, nil
+	}
+	return []LedgerInformation{{Ledgers: []Ledger{
+		{Currency: "SEK", AccountSum: Amount{d("500"), "SEK"}, ExchangeRate: Amount{d("1"), "SEK"}},
+		{Currency: "EUR", AccountSum: Amount{d("10"), "EUR"}, ExchangeRate: Amount{d("11"), "SEK"}},
+		{Currency: "NOK", AccountSum: Amount{d("10"), "NOK"}},
+	}}}, nil
+}
+
+func snapshotPositions(accountno int64) ([]Position, error) {
+	positions := []Position{{
+		Accno: accountno, Instrument: eric, Qty: 100,
+		MarketValueAcc: Amount{d("10000"), "SEK"}, MarketValue: Amount{d("10000"), "SEK"},
+	}}
+	if accountno == 1 {
+		positions = append(positions, Position{
+			Accno: 1, Instrument: aapl, Qty: 10,
+			MarketValueAcc: Amount{d("15000"), "SEK"}, MarketValue: Amount{d("1500"), "USD"},
+		})
+	}
+	return positions, nil
+}
+
+func TestConsolidate(t *testing.T) {
+	snapshot, err := Consolidate(fakeFetcher{positionsFunc: snapshotPositions}, "EUR")
+	assert.NoError(t, err)
+
+	assert.Len(t, snapshot.Accounts, 2)
+	assert.Equal(t, Amount{d("25000"), "SEK"}, snapshot.Accounts[0].MarketValue)
+	assert.Equal(t, Amount{d("10000"), "SEK"}, snapshot.Accounts[1].MarketValue)
+
+	assert.Equal(t, []Amount{{d("10"), "EUR"}, {d("10"), "NOK"}, {d("1500"), "SEK"}, {d("100"), "USD"}}, snapshot.Cash)
+	assert.Equal(t, []Amount{{d("20000"), "SEK"}, {d("1500"), "USD"}}, snapshot.MarketValue)
+	assert.Equal(t, []Amount{{d("10"), "EUR"}, {d("10"), "NOK"}, {d("21500"), "SEK"}, {d("1600"), "USD"}}, snapshot.Totals)
+
+	// SEK and USD are converted through SEK, NOK has no rate
+	assert.Equal(t, []string{"NOK"}, snapshot.MissingRates)
+	assert.Equal(t, "EUR", snapshot.Total.Currency)
+	expected := d("10").Add(d("21500").Mul(DecimalFromInt(1).Div(d("11")))).Add(d("1600").Mul(d("10").Div(d("11"))))
+	assert.Equal(t, expected, snapshot.Total.Value)
+
+	assert.Len(t, snapshot.Holdings, 2)
+	assert.Equal(t, "ERIC B", snapshot.Holdings[0].Instrument.Symbol)
+	assert.Equal(t, []int64{1, 2}, snapshot.Holdings[0].Accnos)
+	assert.Equal(t, 200.0, snapshot.Holdings[0].Qty)
+	assert.Equal(t, Amount{d("20000"), "SEK"}, snapshot.Holdings[0].MarketValue)
+	assert.Equal(t, "AAPL", snapshot.Holdings[1].Instrument.Symbol)
+}
+
+func TestConsolidatorClock(t *testing.T) {
+	at := time.Date(2023, 1, 2, 17, 0, 0, 0, time.UTC)
+	consolidator := NewConsolidator(fakeFetcher{positionsFunc: snapshotPositions}, "SEK")
+	consolidator.Clock = func() time.Time { return at }
+
+	snapshot, err := consolidator.Snapshot()
+	assert.NoError(t, err)
+	assert.Equal(t, at, snapshot.At)
+	assert.Equal(t, "SEK", snapshot.Total.Currency)
+}
+
+func TestConsolidateError(t *testing.T) {
+	_, err := Consolidate(fakeFetcher{positionsFunc: snapshotPositions, failLedgers: true}, "SEK")
+	assert.EqualError(t, err, "ledgers unavailable")
+}
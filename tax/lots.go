@@ -0,0 +1,332 @@
+/*
+Tracks the tax lots of traded instruments and the realised gains of sales, with the FIFO or the Swedish average cost method
+*/
+package tax
+
+import (
+	"fmt"
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How the cost of a sale is determined
+type Method string
+
+const (
+	// The oldest lots are sold first
+	FIFO Method = "fifo"
+
+	// Genomsnittsmetoden, all purchases of an instrument form a single lot at the average price
+	AverageCost Method = "average"
+)
+
+func (m Method) String() string {
+	return string(m)
+}
+
+// Returned when no method is given or it's unknown
+type UnknownMethodError struct {
+	Method Method
+}
+
+// UnknownMethodError implements the error interface
+func (e UnknownMethodError) Error() string {
+	return fmt.Sprintf("Unknown tax lot method %q", string(e.Method))
+}
+
+// A quantity of an instrument bought together, or all of it with AverageCost. Cost is in the base currency.
+type Lot struct {
+	Accno    int64
+	Tradable TradableId
+
+	// The instrument of the tradable, zero if it isn't in Book.Instruments
+	Instrument int64
+
+	// The opening trade, empty for an average cost lot
+	TradeId string
+
+	// Time of the opening trade, the first purchase of an average cost lot
+	Acquired time.Time
+
+	Qty  float64
+	Cost Amount
+}
+
+// The cost per unit in the base currency
+func (l Lot) Price() Amount {
+	if l.Qty == 0 {
+		return Amount{Currency: l.Cost.Currency}
+	}
+	return Amount{l.Cost.Value.Div(DecimalFromFloat(l.Qty)), l.Cost.Currency}
+}
+
+// A sell trade and its realised gain, amounts are in the base currency except Price
+type Sale struct {
+	Accno    int64
+	Tradable TradableId
+
+	// The instrument of the tradable, zero if it isn't in Book.Instruments
+	Instrument int64
+
+	TradeId string
+	At      time.Time
+	Qty     float64
+
+	// Trade price in the trade currency
+	Price Amount
+
+	Proceeds Amount
+	Cost     Amount
+	Gain     Amount
+
+	// The parts of the lots sold, a single part with AverageCost
+	Lots []Lot
+
+	// Quantity sold without any lots to match, e.g. when the history is incomplete. It has no cost.
+	Unmatched float64
+}
+
+// Book keeps the lots per account and instrument and realises the gains of sell trades. Trades have to be
+// added in the order they happened, Process sorts them. Trades already added are ignored.
+type Book struct {
+	Method Method
+
+	// Currency of costs and gains
+	Base string
+
+	// Converts trades in other currencies to Base at the rate on the trade time, as the tax rules require,
+	// e.g. an fx.History with the daily rates. Required if any trade isn't in Base.
+	Rates fx.DatedConverter
+
+	// Instruments of the traded tradables. Lots are kept per instrument, so a sale on another market than
+	// the purchase, e.g. one routed through smart order, is matched with it. Other tradables are kept apart.
+	Instruments map[TradableId]Instrument
+
+	lots  map[lotKey][]Lot
+	sales []Sale
+	seen  map[string]bool
+
+	sync.Mutex
+}
+
+type lotKey struct {
+	accno    int64
+	security security
+}
+
+// Identifies a security, the instrument or the tradable if the instrument isn't known
+type security struct {
+	instrument int64
+	tradable   TradableId
+}
+
+func securityOf(instrument int64, tradable TradableId) security {
+	if instrument != 0 {
+		return security{instrument: instrument}
+	}
+	return security{tradable: tradable}
+}
+
+// Quantities smaller than this are treated as zero, to absorb float rounding
+const epsilon = 1e-9
+
+func NewBook(method Method, base string) *Book {
+	return &Book{Method: method, Base: base}
+}
+
+// Adds a trade, returning the sale if it's a sell
+func (b *Book) Add(trade Trade) (*Sale, error) {
+	if b.Method != FIFO && b.Method != AverageCost {
+		return nil, UnknownMethodError{b.Method}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.lots == nil {
+		b.lots = map[lotKey][]Lot{}
+		b.seen = map[string]bool{}
+	}
+	if trade.TradeId != "" && b.seen[trade.TradeId] {
+		return nil, nil
+	}
+
+	value, err := b.toBase(Amount{trade.Price.Value.Mul(DecimalFromFloat(trade.Volume)), trade.Price.Currency}, trade.Tradetime.Time())
+	if err != nil {
+		return nil, err
+	}
+
+	// Only marked as seen once applied, so a trade that failed can be added again
+	var sale *Sale
+	instrument := b.Instruments[trade.Tradable].InstrumentId
+	key := lotKey{trade.Accno, securityOf(instrument, trade.Tradable)}
+	switch trade.Side {
+	case Buy:
+		b.buy(key, trade, instrument, value)
+	case Sell:
+		s := b.sell(key, trade, instrument, value)
+		b.sales = append(b.sales, s)
+		sale = &s
+	default:
+		return nil, fmt.Errorf("Trade %s has unknown side %q", trade.TradeId, string(trade.Side))
+	}
+
+	if trade.TradeId != "" {
+		b.seen[trade.TradeId] = true
+	}
+	return sale, nil
+}
+
+// Adds the trades in the order they happened, returning the sales
+func (b *Book) Process(trades []Trade) ([]Sale, error) {
+	sorted := make([]Trade, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Tradetime < sorted[j].Tradetime })
+
+	res := []Sale{}
+	for _, trade := range sorted {
+		sale, err := b.Add(trade)
+		if err != nil {
+			return res, err
+		}
+		if sale != nil {
+			res = append(res, *sale)
+		}
+	}
+	return res, nil
+}
+
+// Returns all sales in the order they were added
+func (b *Book) Sales() []Sale {
+	b.Lock()
+	defer b.Unlock()
+
+	res := make([]Sale, len(b.sales))
+	copy(res, b.sales)
+	return res
+}
+
+// Returns the remaining lots sorted by account, tradable and acquisition
+func (b *Book) Lots() []Lot {
+	b.Lock()
+	defer b.Unlock()
+
+	res := []Lot{}
+	for _, lots := range b.lots {
+		res = append(res, lots...)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Accno != res[j].Accno {
+			return res[i].Accno < res[j].Accno
+		}
+		if res[i].Tradable != res[j].Tradable {
+			return res[i].Tradable.String() < res[j].Tradable.String()
+		}
+		return res[i].Acquired.Before(res[j].Acquired)
+	})
+	return res
+}
+
+// Returns the sum of the realised gains of the sales in [from, to), zero times leave the range open
+func (b *Book) Realised(from, to time.Time) Amount {
+	b.Lock()
+	defer b.Unlock()
+
+	res := Amount{Currency: b.Base}
+	for _, sale := range b.sales {
+		if (!from.IsZero() && sale.At.Before(from)) || (!to.IsZero() && !sale.At.Before(to)) {
+			continue
+		}
+		res.Value = res.Value.Add(sale.Gain.Value)
+	}
+	return res
+}
+
+// Must be called with the lock held
+func (b *Book) buy(key lotKey, trade Trade, instrument int64, value Amount) {
+	lot := Lot{
+		Accno:      trade.Accno,
+		Tradable:   trade.Tradable,
+		Instrument: instrument,
+		TradeId:    trade.TradeId,
+		Acquired:   trade.Tradetime.Time(),
+		Qty:        trade.Volume,
+		Cost:       value,
+	}
+
+	lots := b.lots[key]
+	if b.Method == AverageCost && len(lots) > 0 {
+		lots[0].Qty += lot.Qty
+		lots[0].Cost.Value = lots[0].Cost.Value.Add(lot.Cost.Value)
+		return
+	}
+	if b.Method == AverageCost {
+		lot.TradeId = ""
+	}
+	b.lots[key] = append(lots, lot)
+}
+
+// Must be called with the lock held
+func (b *Book) sell(key lotKey, trade Trade, instrument int64, proceeds Amount) Sale {
+	sale := Sale{
+		Accno:      trade.Accno,
+		Tradable:   trade.Tradable,
+		Instrument: instrument,
+		TradeId:    trade.TradeId,
+		At:         trade.Tradetime.Time(),
+		Qty:        trade.Volume,
+		Price:      trade.Price,
+		Proceeds:   proceeds,
+		Cost:       Amount{Currency: b.Base},
+		Lots:       []Lot{},
+	}
+
+	lots := b.lots[key]
+	remaining := trade.Volume
+	for len(lots) > 0 && remaining > epsilon {
+		lot := &lots[0]
+		part := *lot
+		if lot.Qty-remaining > epsilon {
+			part.Qty = remaining
+			part.Cost.Value = lot.Cost.Value.Mul(DecimalFromFloat(remaining)).Div(DecimalFromFloat(lot.Qty))
+			lot.Qty -= remaining
+			lot.Cost.Value = lot.Cost.Value.Sub(part.Cost.Value)
+		} else {
+			lots = lots[1:]
+		}
+
+		remaining -= part.Qty
+		sale.Lots = append(sale.Lots, part)
+		sale.Cost.Value = sale.Cost.Value.Add(part.Cost.Value)
+	}
+
+	if len(lots) == 0 {
+		delete(b.lots, key)
+	} else {
+		b.lots[key] = lots
+	}
+
+	if remaining > epsilon {
+		sale.Unmatched = remaining
+	}
+	sale.Gain = Amount{proceeds.Value.Sub(sale.Cost.Value), b.Base}
+	return sale
+}
+
+// Must be called with the lock held
+func (b *Book) toBase(amount Amount, at time.Time) (Amount, error) {
+	if amount.Currency == b.Base || amount.Currency == "" {
+		return Amount{amount.Value, b.Base}, nil
+	}
+	if b.Rates == nil {
+		return Amount{}, fx.MissingRateError{From: amount.Currency, To: b.Base}
+	}
+	converted, err := b.Rates.ConvertAt(amount, b.Base, at)
+	if err != nil {
+		return Amount{}, err
+	}
+	return converted.Amount, nil
+}
@@ -0,0 +1,156 @@
+package tax
+
+import (
+	"github.com/denro/nordnet/fx"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func d(s string) Decimal {
+	return MustDecimal(s)
+}
+
+var eric = TradableId{"101", 11}
+
+func trade(id string, side Side, volume float64, price string, day int64) Trade {
+	return Trade{
+		Accno:     1,
+		TradeId:   id,
+		Tradable:  eric,
+		Side:      side,
+		Volume:    volume,
+		Price:     Amount{d(price), "SEK"},
+		Tradetime: Timestamp(day * 86400000),
+	}
+}
+
+var history = []Trade{
+	trade("c", Sell, 150, "120", 3),
+	trade("a", Buy, 100, "100", 1),
+	trade("b", Buy, 100, "110", 2),
+}
+
+func TestBookFIFO(t *testing.T) {
+	book := NewBook(FIFO, "SEK")
+	sales, err := book.Process(history)
+	assert.NoError(t, err)
+	assert.Len(t, sales, 1)
+
+	sale := sales[0]
+	assert.Equal(t, Amount{d("18000"), "SEK"}, sale.Proceeds)
+	assert.Equal(t, Amount{d("15500"), "SEK"}, sale.Cost)
+	assert.Equal(t, Amount{d("2500"), "SEK"}, sale.Gain)
+	assert.Len(t, sale.Lots, 2)
+	assert.Equal(t, "a", sale.Lots[0].TradeId)
+	assert.Equal(t, 50.0, sale.Lots[1].Qty)
+
+	lots := book.Lots()
+	assert.Len(t, lots, 1)
+	assert.Equal(t, "b", lots[0].TradeId)
+	assert.Equal(t, 50.0, lots[0].Qty)
+	assert.Equal(t, Amount{d("5500"), "SEK"}, lots[0].Cost)
+	assert.Equal(t, Amount{d("110"), "SEK"}, lots[0].Price())
+
+	// trades already added are ignored
+	sales, err = book.Process(history)
+	assert.NoError(t, err)
+	assert.Empty(t, sales)
+	assert.Equal(t, Amount{d("2500"), "SEK"}, book.Realised(time.Time{}, time.Time{}))
+	assert.Equal(t, Amount{Currency: "SEK"}, book.Realised(time.Time{}, time.Unix(3*86400, 0)))
+}
+
+func TestBookAverageCost(t *testing.T) {
+	book := NewBook(AverageCost, "SEK")
+	sales, err := book.Process(history)
+	assert.NoError(t, err)
+
+	sale := sales[0]
+	assert.Equal(t, Amount{d("15750"), "SEK"}, sale.Cost)
+	assert.Equal(t, Amount{d("2250"), "SEK"}, sale.Gain)
+	assert.Len(t, sale.Lots, 1)
+
+	lots := book.Lots()
+	assert.Len(t, lots, 1)
+	assert.Equal(t, "", lots[0].TradeId)
+	assert.Equal(t, time.Unix(86400, 0).UTC(), lots[0].Acquired)
+	assert.Equal(t, 50.0, lots[0].Qty)
+	assert.Equal(t, Amount{d("105"), "SEK"}, lots[0].Price())
+
+	// selling the rest closes the position, selling more is unmatched
+	sale2, err := book.Add(trade("d", Sell, 60, "100", 4))
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, sale2.Unmatched)
+	assert.Equal(t, Amount{d("5250"), "SEK"}, sale2.Cost)
+	assert.Empty(t, book.Lots())
+}
+
+func TestBookMarkets(t *testing.T) {
+	// bought through smart order, sold on the primary market
+	smart := TradableId{"101", 80}
+	buy := trade("a", Buy, 100, "100", 1)
+	buy.Tradable = smart
+	sell := trade("b", Sell, 100, "120", 2)
+
+	book := NewBook(AverageCost, "SEK")
+	book.Instruments = map[TradableId]Instrument{
+		eric:  {InstrumentId: 16099, Symbol: "ERIC B"},
+		smart: {InstrumentId: 16099, Symbol: "ERIC B"},
+	}
+	sales, err := book.Process([]Trade{buy, sell})
+	assert.NoError(t, err)
+	if assert.Len(t, sales, 1) {
+		assert.EqualValues(t, 16099, sales[0].Instrument)
+		assert.Zero(t, sales[0].Unmatched)
+		assert.Equal(t, Amount{d("10000"), "SEK"}, sales[0].Cost)
+		assert.Equal(t, Amount{d("2000"), "SEK"}, sales[0].Gain)
+	}
+	assert.Empty(t, book.Lots())
+
+	// without the instruments the markets are kept apart
+	sales, err = NewBook(AverageCost, "SEK").Process([]Trade{buy, sell})
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, sales[0].Unmatched)
+}
+
+func TestBookCurrencies(t *testing.T) {
+	day := func(n int64) time.Time { return Timestamp(n * 86400000).Time() }
+	rates := fx.NewHistory()
+	rates.Set(fx.Rate{From: "USD", To: "SEK", Value: d("10"), At: day(1)})
+	rates.Set(fx.Rate{From: "USD", To: "SEK", Value: d("11"), At: day(2)})
+	rates.Set(fx.Rate{From: "USD", To: "SEK", Value: d("12"), At: day(3)})
+
+	book := NewBook(FIFO, "SEK")
+	aapl := TradableId{"AAPL", 19}
+	buy := Trade{Accno: 1, TradeId: "a", Tradable: aapl, Side: Buy, Volume: 10, Price: Amount{d("100"), "USD"}, Tradetime: TimestampOf(day(1))}
+	sell := Trade{Accno: 1, TradeId: "b", Tradable: aapl, Side: Sell, Volume: 10, Price: Amount{d("100"), "USD"}, Tradetime: TimestampOf(day(2))}
+
+	_, err := book.Add(buy)
+	assert.Equal(t, fx.MissingRateError{From: "USD", To: "SEK"}, err)
+
+	// both trades are converted at the rate of their own day, not the latest rate
+	book.Rates = rates
+	sales, err := book.Process([]Trade{sell, buy})
+	assert.NoError(t, err)
+	if assert.Len(t, sales, 1) {
+		assert.Equal(t, Amount{d("11000"), "SEK"}, sales[0].Proceeds)
+		assert.Equal(t, Amount{d("10000"), "SEK"}, sales[0].Cost)
+		assert.Equal(t, Amount{d("1000"), "SEK"}, sales[0].Gain)
+	}
+
+	_, err = NewBook("", "SEK").Add(buy)
+	assert.EqualError(t, err, `Unknown tax lot method ""`)
+}
+
+func TestBookRetryAfterError(t *testing.T) {
+	book := NewBook(FIFO, "SEK")
+	bad := trade("a", "", 100, "100", 1)
+	_, err := book.Add(bad)
+	assert.EqualError(t, err, `Trade a has unknown side ""`)
+
+	// the failed trade isn't remembered, so the corrected one is applied
+	_, err = book.Add(trade("a", Buy, 100, "100", 1))
+	assert.NoError(t, err)
+	assert.Len(t, book.Lots(), 1)
+}
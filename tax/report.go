@@ -0,0 +1,207 @@
+package tax
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	. "github.com/denro/nordnet/util/models"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The realised result of one instrument in a year, amounts are in the base currency
+type ReportRow struct {
+	// The tradable of the first sale, sales on other markets are included if the instrument is known
+	Tradable   TradableId `json:"tradable"`
+	Instrument int64      `json:"instrument"`
+
+	Name     string  `json:"name"`
+	Qty      float64 `json:"qty"`
+	Proceeds Decimal `json:"proceeds"`
+	Cost     Decimal `json:"cost"`
+
+	// Gain or Loss is zero, Loss is positive
+	Gain Decimal `json:"gain"`
+	Loss Decimal `json:"loss"`
+
+	// Quantity sold without lots to match, see Sale.Unmatched. Its cost is missing, so the gain is too high.
+	Unmatched float64 `json:"unmatched"`
+}
+
+// Returned by WriteK4 when a row has sales without a known cost
+type UnmatchedError struct {
+	Names []string
+}
+
+// UnmatchedError implements the error interface
+func (e UnmatchedError) Error() string {
+	return fmt.Sprintf("Sales without purchase history, the cost is missing for %v", e.Names)
+}
+
+// Returned by WriteK4 when the report isn't in SEK
+type K4CurrencyError struct {
+	Currency string
+}
+
+// K4CurrencyError implements the error interface
+func (e K4CurrencyError) Error() string {
+	return fmt.Sprintf("The K4 form takes amounts in SEK, the report is in %s", e.Currency)
+}
+
+// The realised results of a year by instrument, sorted by name
+type Report struct {
+	Year     int         `json:"year"`
+	Currency string      `json:"currency"`
+	Rows     []ReportRow `json:"rows"`
+
+	Proceeds Decimal `json:"proceeds"`
+	Cost     Decimal `json:"cost"`
+	Gain     Decimal `json:"gain"`
+	Loss     Decimal `json:"loss"`
+}
+
+// Sums the sales of the year, in Swedish time, by instrument like Book pools the lots, sales of tradables
+// without a known instrument by tradable. Names are e.g. the instrument symbols, the tradable id is used
+// for tradables without one. Only sales of the accounts are included, all if none are given.
+//
+// Pass only the sales of taxable accounts, ISK and KF accounts are taxed on their value instead. All sales
+// must have the same base currency, CurrencyMismatchError is returned otherwise. Sales with an unmatched quantity are flagged on their rows.
+func NewReport(sales []Sale, year int, names map[TradableId]string, accnos ...int64) (*Report, error) {
+	loc := CountryLocation("SE")
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(1, 0, 0)
+
+	included := map[int64]bool{}
+	for _, accno := range accnos {
+		included[accno] = true
+	}
+
+	rows := map[security]*ReportRow{}
+	res := &Report{Year: year, Rows: []ReportRow{}}
+	for _, sale := range sales {
+		if sale.At.Before(from) || !sale.At.Before(to) || (len(accnos) > 0 && !included[sale.Accno]) {
+			continue
+		}
+		if res.Currency == "" {
+			res.Currency = sale.Gain.Currency
+		} else if sale.Gain.Currency != res.Currency {
+			return nil, CurrencyMismatchError{res.Currency, sale.Gain.Currency}
+		}
+
+		key := securityOf(sale.Instrument, sale.Tradable)
+		row, ok := rows[key]
+		if !ok {
+			row = &ReportRow{Tradable: sale.Tradable, Instrument: sale.Instrument}
+			rows[key] = row
+		}
+		if row.Name == "" {
+			row.Name = names[sale.Tradable]
+		}
+		row.Qty += sale.Qty
+		row.Proceeds = row.Proceeds.Add(sale.Proceeds.Value)
+		row.Cost = row.Cost.Add(sale.Cost.Value)
+		row.Unmatched += sale.Unmatched
+	}
+
+	for _, row := range rows {
+		if row.Name == "" {
+			row.Name = row.Tradable.String()
+		}
+		if result := row.Proceeds.Sub(row.Cost); result.Sign() >= 0 {
+			row.Gain = result
+		} else {
+			row.Loss = result.Neg()
+		}
+		res.Rows = append(res.Rows, *row)
+
+		res.Proceeds = res.Proceeds.Add(row.Proceeds)
+		res.Cost = res.Cost.Add(row.Cost)
+		res.Gain = res.Gain.Add(row.Gain)
+		res.Loss = res.Loss.Add(row.Loss)
+	}
+	sort.Slice(res.Rows, func(i, j int) bool {
+		if res.Rows[i].Name != res.Rows[j].Name {
+			return res.Rows[i].Name < res.Rows[j].Name
+		}
+		return res.Rows[i].Tradable.String() < res.Rows[j].Tradable.String()
+	})
+
+	return res, nil
+}
+
+// Writes the rows in the layout of section A of the K4 form, amounts in whole kronor, followed by the sums
+// of the rounded amounts. The gain or loss is computed from the rounded proceeds and cost, so every row adds
+// up. Returns UnmatchedError without writing anything if a row lacks purchase history, as the form would
+// overstate the gain, and K4CurrencyError if the report isn't in SEK.
+func (r *Report) WriteK4(w io.Writer) error {
+	if r.Currency != "SEK" && len(r.Rows) > 0 {
+		return K4CurrencyError{r.Currency}
+	}
+
+	unmatched := []string{}
+	for _, row := range r.Rows {
+		if row.Unmatched > 0 {
+			unmatched = append(unmatched, row.Name)
+		}
+	}
+	if len(unmatched) > 0 {
+		return UnmatchedError{unmatched}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+
+	records := [][]string{{"Antal", "Beteckning/Art", "Försäljningspris", "Omkostnadsbelopp", "Vinst", "Förlust"}}
+	sums := make([]Decimal, 4)
+	for _, row := range r.Rows {
+		proceeds, cost := row.Proceeds.Round(0), row.Cost.Round(0)
+		gain, loss := Decimal{}, Decimal{}
+		if result := proceeds.Sub(cost); result.Sign() >= 0 {
+			gain = result
+		} else {
+			loss = result.Neg()
+		}
+
+		record := []string{formatQty(row.Qty), row.Name}
+		for i, amount := range []Decimal{proceeds, cost, gain, loss} {
+			sums[i] = sums[i].Add(amount)
+			record = append(record, amount.Format(0))
+		}
+		records = append(records, record)
+	}
+	records = append(records, []string{"", "Summa", sums[0].Format(0), sums[1].Format(0), sums[2].Format(0), sums[3].Format(0)})
+
+	return writeRecords(cw, records)
+}
+
+// Writes the rows as CSV with a header, amounts with two decimals. The unmatched column flags rows with a missing cost.
+func (r *Report) WriteCSV(w io.Writer) error {
+	records := [][]string{{"year", "tradable", "name", "qty", "currency", "proceeds", "cost", "gain", "loss", "unmatched"}}
+	for _, row := range r.Rows {
+		records = append(records, []string{
+			strconv.Itoa(r.Year), row.Tradable.String(), row.Name, formatQty(row.Qty), r.Currency,
+			row.Proceeds.Format(2), row.Cost.Format(2), row.Gain.Format(2), row.Loss.Format(2), formatQty(row.Unmatched),
+		})
+	}
+	return writeRecords(csv.NewWriter(w), records)
+}
+
+// Writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func writeRecords(cw *csv.Writer, records [][]string) error {
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func formatQty(qty float64) string {
+	return strconv.FormatFloat(qty, 'f', -1, 64)
+}
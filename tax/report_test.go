@@ -0,0 +1,133 @@
+package tax
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/denro/nordnet/util/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testSales() []Sale {
+	sale := func(accno int64, tradable TradableId, at time.Time, qty float64, proceeds, cost string) Sale {
+		return Sale{
+			Accno: accno, Tradable: tradable, At: at, Qty: qty,
+			Proceeds: Amount{d(proceeds), "SEK"}, Cost: Amount{d(cost), "SEK"},
+			Gain: Amount{d(proceeds).Sub(d(cost)), "SEK"},
+		}
+	}
+	return []Sale{
+		sale(1, eric, time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC), 100, "12000.4", "10000.4"),
+		sale(1, eric, time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC), 50, "5000.6", "5500"),
+		sale(1, TradableId{"AAPL", 19}, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC), 10, "9000", "11000.5"),
+		// new year in Sweden
+		sale(1, eric, time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC), 10, "1000", "900"),
+		sale(2, eric, time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC), 10, "1000", "900"),
+	}
+}
+
+func TestReport(t *testing.T) {
+	report, err := NewReport(testSales(), 2023, map[TradableId]string{eric: "ERIC B"}, 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "SEK", report.Currency)
+	assert.Len(t, report.Rows, 2)
+	assert.Equal(t, "AAPL:19", report.Rows[0].Name)
+	assert.Equal(t, d("2000.5"), report.Rows[0].Loss)
+	assert.Equal(t, "ERIC B", report.Rows[1].Name)
+	assert.Equal(t, 150.0, report.Rows[1].Qty)
+	assert.Equal(t, d("1500.6"), report.Rows[1].Gain)
+	assert.True(t, report.Rows[1].Loss.IsZero())
+	assert.Equal(t, d("1500.6"), report.Gain)
+	assert.Equal(t, d("2000.5"), report.Loss)
+
+	report, _ = NewReport(testSales(), 2023, nil)
+	assert.Len(t, report.Rows, 2)
+	report, _ = NewReport(testSales(), 2024, nil)
+	assert.Len(t, report.Rows, 1)
+
+	sales := append(testSales(), Sale{Accno: 1, Tradable: eric, At: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC), Gain: Amount{Currency: "USD"}})
+	_, err = NewReport(sales, 2023, nil)
+	assert.Equal(t, CurrencyMismatchError{"SEK", "USD"}, err)
+}
+
+func TestReportUnmatched(t *testing.T) {
+	sales := append(testSales(), Sale{
+		Accno: 1, Tradable: eric, At: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC), Qty: 5, Unmatched: 5,
+		Proceeds: Amount{d("500"), "SEK"}, Cost: Amount{Currency: "SEK"}, Gain: Amount{d("500"), "SEK"},
+	})
+	report, err := NewReport(sales, 2023, map[TradableId]string{eric: "ERIC B"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, report.Rows[0].Unmatched)
+	assert.Equal(t, 5.0, report.Rows[1].Unmatched)
+
+	var buf bytes.Buffer
+	assert.Equal(t, UnmatchedError{[]string{"ERIC B"}}, report.WriteK4(&buf))
+	assert.Empty(t, buf.String())
+
+	assert.NoError(t, report.WriteCSV(&buf))
+	assert.Contains(t, buf.String(), "2023,101:11,ERIC B,155,SEK,17501.00,15500.40,2000.60,0.00,5\n")
+}
+
+func TestReportInstruments(t *testing.T) {
+	smart := TradableId{"101", 80}
+	sales := testSales()[:2]
+	sales[0].Tradable, sales[0].Instrument = smart, 16099
+	sales[1].Instrument = 16099
+
+	report, err := NewReport(sales, 2023, map[TradableId]string{eric: "ERIC B"})
+	assert.NoError(t, err)
+	if assert.Len(t, report.Rows, 1) {
+		assert.Equal(t, "ERIC B", report.Rows[0].Name)
+		assert.EqualValues(t, 16099, report.Rows[0].Instrument)
+		assert.Equal(t, 150.0, report.Rows[0].Qty)
+	}
+}
+
+func TestReportK4(t *testing.T) {
+	sale := Sale{
+		Accno: 1, Tradable: eric, At: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC), Qty: 1,
+		Proceeds: Amount{d("100.5"), "SEK"}, Cost: Amount{d("50.4"), "SEK"}, Gain: Amount{d("50.1"), "SEK"},
+	}
+	report, err := NewReport([]Sale{sale}, 2023, nil)
+	assert.NoError(t, err)
+
+	// the gain is that of the rounded amounts
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteK4(&buf))
+	assert.Equal(t, "Antal;Beteckning/Art;Försäljningspris;Omkostnadsbelopp;Vinst;Förlust\n"+
+		"1;101:11;101;50;51;0\n"+
+		";Summa;101;50;51;0\n", buf.String())
+
+	sale.Proceeds.Currency, sale.Cost.Currency, sale.Gain.Currency = "USD", "USD", "USD"
+	report, err = NewReport([]Sale{sale}, 2023, nil)
+	assert.NoError(t, err)
+	buf.Reset()
+	assert.Equal(t, K4CurrencyError{"USD"}, report.WriteK4(&buf))
+	assert.Empty(t, buf.String())
+}
+
+func TestReportExports(t *testing.T) {
+	report, err := NewReport(testSales(), 2023, map[TradableId]string{eric: "ERIC B"}, 1)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteK4(&buf))
+	assert.Equal(t, "Antal;Beteckning/Art;Försäljningspris;Omkostnadsbelopp;Vinst;Förlust\n"+
+		"10;AAPL:19;9000;11001;0;2001\n"+
+		"150;ERIC B;17001;15500;1501;0\n"+
+		";Summa;26001;26501;1501;2001\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, report.WriteCSV(&buf))
+	assert.Equal(t, "year,tradable,name,qty,currency,proceeds,cost,gain,loss,unmatched\n"+
+		"2023,AAPL:19,AAPL:19,10,SEK,9000.00,11000.50,0.00,2000.50,0\n"+
+		"2023,101:11,ERIC B,150,SEK,17001.00,15500.40,1500.60,0.00,0\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, report.WriteJSON(&buf))
+	var decoded Report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Environment variables read by EnvProvider when no names are given
+const (
+	DefaultUserEnv = "NORDNET_USER"
+	DefaultPassEnv = "NORDNET_PASS"
+	DefaultPemEnv  = "NORDNET_PEM"
+)
+
+// A CredentialProvider produces a fresh credentials string every time it is called,
+// so that the timestamp embedded in the encrypted blob is always current.
+type CredentialProvider interface {
+	Credentials() (string, error)
+}
+
+// A TimedCredentialProvider can stamp the credentials with a given time instead of the local clock.
+// All providers in this package implement it.
+type TimedCredentialProvider interface {
+	CredentialProvider
+	CredentialsAt(now time.Time) (string, error)
+}
+
+// Secrets holds the raw values needed by GenerateCredentials
+type Secrets struct {
+	Username, Password, Pem []byte
+}
+
+// Zero clears all the secret buffers
+func (s *Secrets) Zero() {
+	Zero(s.Username)
+	Zero(s.Password)
+	Zero(s.Pem)
+}
+
+// Generates credentials from the secrets and zeroes them afterwards
+func (s *Secrets) credentials(now time.Time) (string, error) {
+	defer s.Zero()
+
+	if len(s.Username) == 0 || len(s.Password) == 0 || len(s.Pem) == 0 {
+		return "", errors.New("Missing username, password or PEM")
+	}
+
+	return GenerateCredentialsAt(s.Username, s.Password, s.Pem, now)
+}
+
+// CallbackProvider calls the function on every login, the returned secrets are zeroed after use.
+type CallbackProvider func() (*Secrets, error)
+
+// CallbackProvider implements the CredentialProvider interface
+func (f CallbackProvider) Credentials() (string, error) {
+	return f.CredentialsAt(time.Now())
+}
+
+// CallbackProvider implements the TimedCredentialProvider interface
+func (f CallbackProvider) CredentialsAt(now time.Time) (string, error) {
+	s, err := f()
+	if err != nil {
+		return "", err
+	}
+	return s.credentials(now)
+}
+
+// EnvProvider reads username, password and PEM from environment variables.
+// The PEM variable may contain the key itself or a path to a file containing it.
+type EnvProvider struct {
+	UserVar, PassVar, PemVar string
+}
+
+// Returns an EnvProvider reading the default variables
+func NewEnvProvider() *EnvProvider {
+	return &EnvProvider{DefaultUserEnv, DefaultPassEnv, DefaultPemEnv}
+}
+
+// EnvProvider implements the CredentialProvider interface
+func (p *EnvProvider) Credentials() (string, error) {
+	return p.CredentialsAt(time.Now())
+}
+
+// EnvProvider implements the TimedCredentialProvider interface
+func (p *EnvProvider) CredentialsAt(now time.Time) (string, error) {
+	s := &Secrets{
+		Username: []byte(os.Getenv(p.UserVar)),
+		Password: []byte(os.Getenv(p.PassVar)),
+	}
+
+	pemVal := os.Getenv(p.PemVar)
+	if pemVal != "" && !strings.Contains(pemVal, "-----BEGIN") {
+		raw, err := ioutil.ReadFile(pemVal)
+		if err != nil {
+			s.Zero()
+			return "", err
+		}
+		s.Pem = raw
+	} else {
+		s.Pem = []byte(pemVal)
+	}
+
+	if len(s.Username) == 0 || len(s.Password) == 0 {
+		s.Zero()
+		return "", fmt.Errorf("Environment variables %s and %s must be set", p.UserVar, p.PassVar)
+	}
+
+	return s.credentials(now)
+}
+
+// FileProvider reads username, password and PEM from separate files, surrounding whitespace is trimmed from username and password.
+type FileProvider struct {
+	UserFile, PassFile, PemFile string
+}
+
+// FileProvider implements the CredentialProvider interface
+func (p *FileProvider) Credentials() (string, error) {
+	return p.CredentialsAt(time.Now())
+}
+
+// FileProvider implements the TimedCredentialProvider interface
+func (p *FileProvider) CredentialsAt(now time.Time) (string, error) {
+	s := &Secrets{}
+
+	var err error
+	if s.Username, err = readSecret(p.UserFile); err != nil {
+		return "", err
+	}
+	if s.Password, err = readSecret(p.PassFile); err != nil {
+		s.Zero()
+		return "", err
+	}
+	if s.Pem, err = ioutil.ReadFile(p.PemFile); err != nil {
+		s.Zero()
+		return "", err
+	}
+
+	return s.credentials(now)
+}
+
+// Reads a file and returns a trimmed copy, the original buffer is zeroed
+func readSecret(path string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(raw)
+
+	trimmed := bytes.TrimSpace(raw)
+	return append([]byte(nil), trimmed...), nil
+}
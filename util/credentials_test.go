@@ -0,0 +1,159 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// Decrypts the credentials and returns the decoded user, pass and timestamp
+func decryptCredentials(t *testing.T, key *rsa.PrivateKey, cred string) []string {
+	encr, err := base64.StdEncoding.DecodeString(cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := rsa.DecryptPKCS1v15(nil, key, encr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(string(plain), ":")
+	for i, p := range parts {
+		decoded, _ := base64.StdEncoding.DecodeString(p)
+		parts[i] = string(decoded)
+	}
+	return parts
+}
+
+func TestGenerateCredentials(t *testing.T) {
+	key, pemData := testKey(t)
+
+	cred, err := GenerateCredentials([]byte("user"), []byte("pass"), pemData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := decryptCredentials(t, key, cred)
+	assert.Equal(t, "user", parts[0])
+	assert.Equal(t, "pass", parts[1])
+	assert.Len(t, parts[2], 13)
+}
+
+func TestCallbackProvider(t *testing.T) {
+	key, pemData := testKey(t)
+
+	s := &Secrets{[]byte("user"), []byte("pass"), pemData}
+	provider := CallbackProvider(func() (*Secrets, error) { return s, nil })
+
+	cred, err := provider.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := decryptCredentials(t, key, cred)
+	assert.Equal(t, "user", parts[0])
+	assert.Equal(t, "pass", parts[1])
+
+	assert.Equal(t, []byte{0, 0, 0, 0}, s.Username)
+	assert.Equal(t, []byte{0, 0, 0, 0}, s.Password)
+}
+
+func TestEnvProvider(t *testing.T) {
+	key, pemData := testKey(t)
+
+	t.Setenv("TEST_NN_USER", "user")
+	t.Setenv("TEST_NN_PASS", "pass")
+	t.Setenv("TEST_NN_PEM", string(pemData))
+
+	provider := &EnvProvider{"TEST_NN_USER", "TEST_NN_PASS", "TEST_NN_PEM"}
+	cred, err := provider.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "user", decryptCredentials(t, key, cred)[0])
+
+	t.Setenv("TEST_NN_PASS", "")
+	_, err = provider.Credentials()
+	assert.EqualError(t, err, "Environment variables TEST_NN_USER and TEST_NN_PASS must be set")
+}
+
+func TestFileProvider(t *testing.T) {
+	key, pemData := testKey(t)
+	dir := t.TempDir()
+
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	provider := &FileProvider{
+		UserFile: write("user", []byte("user\n")),
+		PassFile: write("pass", []byte(" pass \n")),
+		PemFile:  write("key.pem", pemData),
+	}
+
+	cred, err := provider.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := decryptCredentials(t, key, cred)
+	assert.Equal(t, "user", parts[0])
+	assert.Equal(t, "pass", parts[1])
+}
+
+func TestVaultProvider(t *testing.T) {
+	key, pemData := testKey(t)
+	path := filepath.Join(t.TempDir(), "vault.json")
+
+	if err := WriteVault(path, []byte("secret"), &Secrets{[]byte("user"), []byte("pass"), pemData}); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &VaultProvider{Path: path, Passphrase: func() ([]byte, error) { return []byte("secret"), nil }}
+	cred, err := provider.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := decryptCredentials(t, key, cred)
+	assert.Equal(t, "user", parts[0])
+	assert.Equal(t, "pass", parts[1])
+
+	_, err = OpenVault(path, []byte("wrong"))
+	assert.Equal(t, VaultPassphraseError, err)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `"iterations":200000`, `"iterations":1`, 1)
+	assert.NotEqual(t, string(data), tampered)
+	if err = ioutil.WriteFile(path, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenVault(path, []byte("secret"))
+	assert.Equal(t, VaultIterationsError, err)
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+)
+
+var (
+	UnsupportedKeyError = errors.New("Only ed25519 and RSA private keys are supported")
+)
+
+// Parses an ed25519 or RSA private key in PEM (PKCS#1, PKCS#8) or OpenSSH format.
+// The passphrase is only used for encrypted keys and may be nil.
+func ParsePrivateKey(raw, passphrase []byte) (crypto.Signer, error) {
+	var (
+		key interface{}
+		err error
+	)
+
+	if len(passphrase) > 0 {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(raw, passphrase)
+	} else {
+		key, err = ssh.ParseRawPrivateKey(raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ed25519.PrivateKey:
+		return *k, nil
+	case *rsa.PrivateKey:
+		return k, nil
+	}
+
+	return nil, UnsupportedKeyError
+}
+
+// Reads and parses the private key at path, the file contents are zeroed after parsing.
+func LoadPrivateKey(path string, passphrase []byte) (crypto.Signer, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer Zero(raw)
+
+	return ParsePrivateKey(raw, passphrase)
+}
+
+// Signs the challenge returned by the server and returns the base64 encoded signature.
+// Ed25519 keys sign the challenge directly, RSA keys use PKCS#1 v1.5 with SHA-256.
+func SignChallenge(key crypto.Signer, challenge string) (string, error) {
+	var (
+		sig []byte
+		err error
+	)
+
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(challenge))
+	case *rsa.PrivateKey:
+		hashed := sha256.Sum256([]byte(challenge))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hashed[:])
+	default:
+		err = UnsupportedKeyError
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
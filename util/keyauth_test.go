@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"testing"
+)
+
+func verifyChallenge(t *testing.T, key crypto.Signer, challenge, signature string) {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch pub := key.Public().(type) {
+	case ed25519.PublicKey:
+		assert.True(t, ed25519.Verify(pub, []byte(challenge), sig))
+	case *rsa.PublicKey:
+		hashed := sha256.Sum256([]byte(challenge))
+		assert.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig))
+	default:
+		t.Fatalf("unexpected key type %T", pub)
+	}
+}
+
+func TestParsePrivateKeyPKCS8Ed25519(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := SignChallenge(key, "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyChallenge(t, key, "challenge", sig)
+}
+
+func TestParsePrivateKeyPKCS1RSA(t *testing.T) {
+	priv, _ := testKey(t)
+	raw := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+
+	key, err := ParsePrivateKey(raw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := SignChallenge(key, "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyChallenge(t, key, "challenge", sig)
+}
+
+func TestParsePrivateKeyOpenSSH(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := pem.EncodeToMemory(block)
+
+	_, err = ParsePrivateKey(raw, nil)
+	assert.Error(t, err)
+
+	key, err := ParsePrivateKey(raw, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, priv, key)
+}
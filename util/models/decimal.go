@@ -0,0 +1,316 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Number of decimals a Decimal stores
+const DecimalPlaces = 8
+
+const decimalScale int64 = 100000000
+
+var (
+	bigScale = big.NewInt(decimalScale)
+
+	// Limits of the 128 bit two's complement representation
+	maxUnits = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	minUnits = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127))
+
+	// The largest and smallest Decimal, results outside the range saturate to these
+	MaxDecimal = Decimal{math.MaxInt64, math.MaxUint64}
+	MinDecimal = Decimal{math.MinInt64, 0}
+)
+
+// Decimal is an exact decimal number with DecimalPlaces decimals, used for money and prices instead of float64.
+// The zero value is 0, and values are comparable with == and usable as map keys.
+//
+// The value is stored as a 128 bit integer of units, giving a range of about ±1.7e30. Arithmetic whose
+// result is outside the range saturates to MaxDecimal or MinDecimal instead of wrapping around, and
+// ParseDecimal returns an error for such input.
+//
+// It is encoded as a JSON number in its shortest form, decoding also accepts quoted numbers.
+type Decimal struct {
+	hi int64
+	lo uint64
+}
+
+// Parses a decimal number like "-12.345" or "1e-3", digits beyond DecimalPlaces are rounded half away from zero.
+func ParseDecimal(s string) (Decimal, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || strings.Contains(s, "/") {
+		return Decimal{}, fmt.Errorf("Invalid decimal %q", s)
+	}
+
+	d, ok := decimalFromUnits(roundQuo(new(big.Int).Mul(r.Num(), bigScale), r.Denom()))
+	if !ok {
+		return d, fmt.Errorf("Decimal %q out of range", s)
+	}
+	return d, nil
+}
+
+// Like ParseDecimal but panics on invalid input, for constants
+func MustDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func DecimalFromInt(i int64) Decimal {
+	d, _ := decimalFromUnits(new(big.Int).Mul(big.NewInt(i), bigScale))
+	return d
+}
+
+// Converts the shortest representation of the float, so DecimalFromFloat(1.1) is exactly 1.1.
+// NaN gives 0 and infinities saturate, use FloatDecimal to get an error instead.
+func DecimalFromFloat(f float64) Decimal {
+	d, _ := FloatDecimal(f)
+	return d
+}
+
+// Like DecimalFromFloat but returns an error for NaN, infinities and floats outside the range.
+func FloatDecimal(f float64) (Decimal, error) {
+	switch {
+	case math.IsNaN(f):
+		return Decimal{}, fmt.Errorf("Invalid decimal %v", f)
+	case math.IsInf(f, 1):
+		return MaxDecimal, fmt.Errorf("Decimal %v out of range", f)
+	case math.IsInf(f, -1):
+		return MinDecimal, fmt.Errorf("Decimal %v out of range", f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// Adds, saturating on overflow
+func (d Decimal) Add(o Decimal) Decimal {
+	lo, carry := bits.Add64(d.lo, o.lo, 0)
+	sum := Decimal{d.hi + o.hi + int64(carry), lo}
+
+	// Overflow only when both have the same sign and the sum has the other
+	if (d.hi < 0) == (o.hi < 0) && (sum.hi < 0) != (d.hi < 0) {
+		if d.hi < 0 {
+			return MinDecimal
+		}
+		return MaxDecimal
+	}
+	return sum
+}
+
+// Subtracts, saturating on overflow
+func (d Decimal) Sub(o Decimal) Decimal {
+	lo, borrow := bits.Sub64(d.lo, o.lo, 0)
+	diff := Decimal{d.hi - o.hi - int64(borrow), lo}
+
+	// Overflow only when the signs differ and the difference has the sign of o
+	if (d.hi < 0) != (o.hi < 0) && (diff.hi < 0) != (d.hi < 0) {
+		if d.hi < 0 {
+			return MinDecimal
+		}
+		return MaxDecimal
+	}
+	return diff
+}
+
+// Multiplies, rounding the result half away from zero and saturating on overflow
+func (d Decimal) Mul(o Decimal) Decimal {
+	p := new(big.Int).Mul(d.bigUnits(), o.bigUnits())
+	res, _ := decimalFromUnits(roundQuo(p, bigScale))
+	return res
+}
+
+// Multiplies with a float, e.g. a volume
+func (d Decimal) MulFloat(f float64) Decimal {
+	return d.Mul(DecimalFromFloat(f))
+}
+
+// Divides, rounding the result half away from zero and saturating on overflow. Panics if o is zero.
+func (d Decimal) Div(o Decimal) Decimal {
+	if o.IsZero() {
+		panic("models: division of Decimal by zero")
+	}
+	n := new(big.Int).Mul(d.bigUnits(), bigScale)
+	res, _ := decimalFromUnits(roundQuo(n, o.bigUnits()))
+	return res
+}
+
+// Negates, -MinDecimal saturates to MaxDecimal
+func (d Decimal) Neg() Decimal {
+	return Decimal{}.Sub(d)
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.hi < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Returns -1, 0 or 1 depending on the sign
+func (d Decimal) Sign() int {
+	switch {
+	case d.hi < 0:
+		return -1
+	case d.hi > 0 || d.lo > 0:
+		return 1
+	}
+	return 0
+}
+
+// Returns -1 if d < o, 0 if they are equal and 1 if d > o
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.hi < o.hi || (d.hi == o.hi && d.lo < o.lo):
+		return -1
+	case d == o:
+		return 0
+	}
+	return 1
+}
+
+func (d Decimal) IsZero() bool {
+	return d == Decimal{}
+}
+
+// Rounds to the number of decimals, half away from zero
+func (d Decimal) Round(decimals int64) Decimal {
+	if decimals >= DecimalPlaces {
+		return d
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	step := new(big.Int).Exp(big.NewInt(10), big.NewInt(DecimalPlaces-decimals), nil)
+	q := roundQuo(d.bigUnits(), step)
+	res, _ := decimalFromUnits(q.Mul(q, step))
+	return res
+}
+
+// Returns the nearest float64
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Formats the shortest exact representation, e.g. "1.1" or "-3"
+func (d Decimal) String() string {
+	s := d.Format(DecimalPlaces)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Formats the value rounded to exactly the number of decimals, e.g. by TickSizeInterval.Decimals
+func (d Decimal) Format(decimals int64) string {
+	if decimals > DecimalPlaces {
+		decimals = DecimalPlaces
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+	d = d.Round(decimals)
+
+	sign := ""
+	abs := d.bigUnits()
+	if abs.Sign() < 0 {
+		sign = "-"
+		abs.Neg(abs)
+	}
+
+	integer, fraction := new(big.Int).QuoRem(abs, bigScale, new(big.Int))
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d", sign, integer)
+	}
+	return fmt.Sprintf("%s%d.%s", sign, integer, fmt.Sprintf("%08d", fraction)[:decimals])
+}
+
+// Decimal implements the json.Marshaler interface
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Decimal implements the json.Unmarshaler interface, accepting numbers, quoted numbers and null
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	if len(b) > 1 && b[0] == '"' {
+		s, err := strconv.Unquote(string(b))
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			*d = Decimal{}
+			return nil
+		}
+		b = []byte(s)
+	}
+
+	parsed, err := ParseDecimal(string(b))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Decimal implements the encoding.TextMarshaler interface
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Decimal implements the encoding.TextUnmarshaler interface
+func (d *Decimal) UnmarshalText(b []byte) (err error) {
+	*d, err = ParseDecimal(string(b))
+	return
+}
+
+// Returns the units as a big.Int
+func (d Decimal) bigUnits() *big.Int {
+	u := new(big.Int).SetInt64(d.hi)
+	u.Lsh(u, 64)
+	return u.Or(u, new(big.Int).SetUint64(d.lo))
+}
+
+// Converts units to a Decimal, saturating and returning false when they are out of range
+func decimalFromUnits(u *big.Int) (Decimal, bool) {
+	if u.Cmp(maxUnits) > 0 {
+		return MaxDecimal, false
+	}
+	if u.Cmp(minUnits) < 0 {
+		return MinDecimal, false
+	}
+
+	lo := new(big.Int).And(u, new(big.Int).SetUint64(math.MaxUint64)).Uint64()
+	hi := new(big.Int).Rsh(u, 64).Int64()
+	return Decimal{hi, lo}, true
+}
+
+// Rounds n/q half away from zero
+func roundQuo(n, q *big.Int) *big.Int {
+	quo, rem := new(big.Int).QuoRem(n, q, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	// |2*rem| >= |q| rounds away from zero
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	if twice.Cmp(new(big.Int).Abs(q)) >= 0 {
+		if (n.Sign() < 0) != (q.Sign() < 0) {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
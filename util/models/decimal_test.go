@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestDecimalArithmetic(t *testing.T) {
+	sum := MustDecimal("1.1").Add(MustDecimal("2.2"))
+	assert.Equal(t, MustDecimal("3.3"), sum)
+	assert.Equal(t, "3.3", sum.String())
+
+	assert.Equal(t, "-1.1", MustDecimal("1.1").Sub(MustDecimal("2.2")).String())
+	assert.Equal(t, "2.42", MustDecimal("1.1").Mul(MustDecimal("2.2")).String())
+	assert.Equal(t, "0.33333333", DecimalFromInt(1).Div(DecimalFromInt(3)).String())
+	assert.Equal(t, "-0.66666667", DecimalFromInt(-2).Div(DecimalFromInt(3)).String())
+	assert.Equal(t, "165", MustDecimal("1.65").MulFloat(100).String())
+	assert.Equal(t, MustDecimal("1.1"), DecimalFromFloat(1.1))
+	assert.Equal(t, 3.3, sum.Float64())
+
+	assert.Equal(t, 1, sum.Cmp(MustDecimal("3.29")))
+	assert.Equal(t, -1, sum.Neg().Sign())
+	assert.Equal(t, sum, sum.Neg().Abs())
+	assert.True(t, Decimal{}.IsZero())
+
+	assert.Panics(t, func() { sum.Div(Decimal{}) })
+}
+
+func TestDecimalRange(t *testing.T) {
+	// Far beyond what an int64 of units could hold
+	huge := MustDecimal("1000000000000000000000.5")
+	assert.Equal(t, "2000000000000000000001", huge.Add(huge).String())
+	assert.Equal(t, "-1000000000000000000000.5", huge.Neg().String())
+	assert.Equal(t, "1000000000000000000000000", MustDecimal("1000000000000").Mul(MustDecimal("1000000000000")).String())
+	assert.Equal(t, "500000000000000000000.25", huge.Div(DecimalFromInt(2)).String())
+	assert.Equal(t, "1000000000000000000001", huge.Round(0).String())
+	assert.Equal(t, -1, huge.Neg().Cmp(DecimalFromInt(-1)))
+	assert.Equal(t, 1, huge.Cmp(DecimalFromInt(1)))
+
+	max, err := ParseDecimal("1701411834604692317316873037158.84105727")
+	assert.NoError(t, err)
+	assert.Equal(t, MaxDecimal, max)
+	min, err := ParseDecimal("-1701411834604692317316873037158.84105728")
+	assert.NoError(t, err)
+	assert.Equal(t, MinDecimal, min)
+
+	_, err = ParseDecimal("1701411834604692317316873037158.84105728")
+	assert.Error(t, err)
+	_, err = ParseDecimal("-1701411834604692317316873037158.84105729")
+	assert.Error(t, err)
+
+	// Results outside the range saturate instead of wrapping around
+	one := MustDecimal("0.00000001")
+	assert.Equal(t, MaxDecimal, max.Add(one))
+	assert.Equal(t, MinDecimal, min.Sub(one))
+	assert.Equal(t, MaxDecimal, max.Sub(one.Neg()))
+	assert.Equal(t, MinDecimal, min.Add(one.Neg()))
+	assert.Equal(t, MaxDecimal, min.Neg())
+	assert.Equal(t, MaxDecimal, max.Mul(DecimalFromInt(2)))
+	assert.Equal(t, MinDecimal, max.Mul(DecimalFromInt(-2)))
+	assert.Equal(t, MaxDecimal, max.Div(MustDecimal("0.5")))
+	assert.Equal(t, max.Sub(one), max.Sub(one).Add(one).Sub(one))
+
+	_, err = FloatDecimal(math.NaN())
+	assert.Error(t, err)
+	d, err := FloatDecimal(math.Inf(-1))
+	assert.Error(t, err)
+	assert.Equal(t, MinDecimal, d)
+	_, err = FloatDecimal(1e40)
+	assert.Error(t, err)
+	d, err = FloatDecimal(-2.5)
+	assert.NoError(t, err)
+	assert.Equal(t, MustDecimal("-2.5"), d)
+	assert.Equal(t, MaxDecimal, DecimalFromFloat(math.Inf(1)))
+	assert.Equal(t, Decimal{}, DecimalFromFloat(math.NaN()))
+}
+
+func TestDecimalParseAndFormat(t *testing.T) {
+	for s, expected := range map[string]string{
+		"0":            "0",
+		"-0.50":        "-0.5",
+		"1e-3":         "0.001",
+		"123456789.12": "123456789.12",
+		"0.123456785":  "0.12345679",
+	} {
+		d, err := ParseDecimal(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, d.String(), s)
+	}
+
+	for _, invalid := range []string{"", "abc", "1/3", "1e31"} {
+		_, err := ParseDecimal(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	d := MustDecimal("12.345")
+	assert.Equal(t, "12.35", d.Format(2))
+	assert.Equal(t, "12", d.Format(0))
+	assert.Equal(t, "12.34500000", d.Format(10))
+	assert.Equal(t, "-12.35", d.Neg().Format(2))
+	assert.Equal(t, "-0.50", MustDecimal("-0.499").Format(2))
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var amount Amount
+	assert.NoError(t, json.Unmarshal([]byte(`{"value":0.30000000000000004,"currency":"SEK"}`), &amount))
+	assert.Equal(t, Amount{MustDecimal("0.3"), "SEK"}, amount)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"value":"12.50","currency":"SEK"}`), &amount))
+	b, err := json.Marshal(amount)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"value":12.5,"currency":"SEK"}`, string(b))
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"value":null}`), &amount))
+	assert.Equal(t, MustDecimal("12.5"), amount.Value)
+	assert.Error(t, json.Unmarshal([]byte(`{"value":"x"}`), &amount))
+
+	prices := map[Decimal]int{MustDecimal("1.10"): 1}
+	b, err = json.Marshal(prices)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"1.1":1}`, string(b))
+}
+
+func TestAmountOperations(t *testing.T) {
+	sek := Amount{MustDecimal("100.5"), "SEK"}
+
+	sum, err := Amount{}.Add(sek)
+	assert.NoError(t, err)
+	assert.Equal(t, sek, sum)
+
+	diff, err := sek.Sub(Amount{MustDecimal("0.5"), "SEK"})
+	assert.NoError(t, err)
+	assert.Equal(t, "100 SEK", diff.String())
+
+	_, err = sek.Add(Amount{DecimalFromInt(1), "EUR"})
+	assert.Equal(t, CurrencyMismatchError{"SEK", "EUR"}, err)
+
+	assert.Equal(t, "201 SEK", sek.Mul(DecimalFromInt(2)).String())
+	assert.Equal(t, "-100.5 SEK", sek.Neg().String())
+}
+
+func TestTickSizes(t *testing.T) {
+	table := TicksizeTable{Ticks: []TickSizeInterval{
+		{Decimals: 2, FromPrice: MustDecimal("0"), ToPrice: MustDecimal("49.99"), Tick: MustDecimal("0.01")},
+		{Decimals: 2, FromPrice: MustDecimal("50"), ToPrice: MustDecimal("99.95"), Tick: MustDecimal("0.05")},
+		{Decimals: 1, FromPrice: MustDecimal("100"), ToPrice: MustDecimal("999.9"), Tick: MustDecimal("0.1")},
+	}}
+
+	assert.Equal(t, "12.30", table.Format(MustDecimal("12.3")))
+	assert.Equal(t, "123.4", table.Format(MustDecimal("123.44")))
+	assert.Equal(t, MustDecimal("51.05"), table.Round(MustDecimal("51.03")))
+	assert.Equal(t, MustDecimal("51"), table.Round(MustDecimal("51.02")))
+	assert.Equal(t, "1000.123", table.Format(MustDecimal("1000.123")))
+	assert.Equal(t, MustDecimal("1000.123"), table.Round(MustDecimal("1000.123")))
+}
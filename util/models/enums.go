@@ -0,0 +1,222 @@
+package models
+
+// The enumerated string fields of orders and trades. Each type has constants for the values
+// documented by Nordnet, values the client doesn't know about are kept as sent and reported by
+// IsUnknown, so they survive decoding and encoding unchanged. All of them are encoded as JSON strings.
+
+// Side of an order or trade
+type Side string
+
+const (
+	Buy  Side = "BUY"
+	Sell Side = "SELL"
+)
+
+// State of an order on the market
+type OrderState string
+
+const (
+	OrderLocal    OrderState = "LOCAL"
+	OrderOnMarket OrderState = "ON_MARKET"
+	OrderDeleted  OrderState = "DELETED"
+	OrderDone     OrderState = "DONE"
+)
+
+// State of the last action (insert, modify or delete) done on an order
+type ActionState string
+
+const (
+	InsertPending   ActionState = "INS_PEND"
+	InsertConfirmed ActionState = "INS_CONF"
+	InsertFailed    ActionState = "INS_FAIL"
+	ModifyPending   ActionState = "MOD_PEND"
+	ModifyConfirmed ActionState = "MOD_CONF"
+	ModifyFailed    ActionState = "MOD_FAIL"
+	DeletePending   ActionState = "DEL_PEND"
+	DeleteConfirmed ActionState = "DEL_CONF"
+	DeleteFailed    ActionState = "DEL_FAIL"
+)
+
+type PriceCondition string
+
+const (
+	PriceLimit PriceCondition = "LIMIT"
+)
+
+type VolumeCondition string
+
+const (
+	VolumeNormal       VolumeCondition = "NORMAL"
+	VolumeAllOrNothing VolumeCondition = "ALL_OR_NOTHING"
+	VolumeFillAndKill  VolumeCondition = "FILL_AND_KILL"
+	VolumeFillOrKill   VolumeCondition = "FILL_OR_KILL"
+)
+
+type ValidityType string
+
+const (
+	ValidDay       ValidityType = "DAY"
+	ValidUntilDate ValidityType = "UNTIL_DATE"
+	ValidImmediate ValidityType = "IMMEDIATE"
+)
+
+type ActivationType string
+
+const (
+	ActivationNone                ActivationType = "NONE"
+	ActivationManual              ActivationType = "MANUAL"
+	ActivationStopPrice           ActivationType = "STOP_ACTPRICE"
+	ActivationStopPricePercent    ActivationType = "STOP_ACTPRICE_PERC"
+	ActivationOneCancelsOtherStop ActivationType = "OCO_STOP_ACTPRICE"
+)
+
+type TriggerCondition string
+
+const (
+	TriggerAtOrBelow TriggerCondition = "<="
+	TriggerAtOrAbove TriggerCondition = ">="
+)
+
+// Result of an order request, anything but OK is a rejection
+type ResultCode string
+
+const (
+	ResultOK ResultCode = "OK"
+)
+
+func (s Side) String() string {
+	return string(s)
+}
+
+func (s Side) IsUnknown() bool {
+	return !isKnown(s, Buy, Sell)
+}
+
+// Returns 1 for Buy, -1 for Sell and 0 for unknown sides, useful when summing volumes
+func (s Side) Sign() int {
+	switch s {
+	case Buy:
+		return 1
+	case Sell:
+		return -1
+	}
+	return 0
+}
+
+func (s OrderState) String() string {
+	return string(s)
+}
+
+func (s OrderState) IsUnknown() bool {
+	return !isKnown(s, OrderLocal, OrderOnMarket, OrderDeleted, OrderDone)
+}
+
+// Reports if the order can still be traded or changed
+func (s OrderState) IsOpen() bool {
+	return s == OrderLocal || s == OrderOnMarket
+}
+
+// Reports if the order is deleted or done, a terminal state never changes again
+func (s OrderState) IsTerminal() bool {
+	return s == OrderDeleted || s == OrderDone
+}
+
+func (s ActionState) String() string {
+	return string(s)
+}
+
+func (s ActionState) IsUnknown() bool {
+	return !isKnown(s, InsertPending, InsertConfirmed, InsertFailed, ModifyPending, ModifyConfirmed, ModifyFailed, DeletePending, DeleteConfirmed, DeleteFailed)
+}
+
+// Reports if the action waits for confirmation from the market
+func (s ActionState) IsPending() bool {
+	return s == InsertPending || s == ModifyPending || s == DeletePending
+}
+
+// Reports if the action was rejected
+func (s ActionState) IsRejected() bool {
+	return s == InsertFailed || s == ModifyFailed || s == DeleteFailed
+}
+
+func (c PriceCondition) String() string {
+	return string(c)
+}
+
+func (c PriceCondition) IsUnknown() bool {
+	return !isKnown(c, PriceLimit)
+}
+
+func (c VolumeCondition) String() string {
+	return string(c)
+}
+
+func (c VolumeCondition) IsUnknown() bool {
+	return !isKnown(c, VolumeNormal, VolumeAllOrNothing, VolumeFillAndKill, VolumeFillOrKill)
+}
+
+func (t ValidityType) String() string {
+	return string(t)
+}
+
+func (t ValidityType) IsUnknown() bool {
+	return !isKnown(t, ValidDay, ValidUntilDate, ValidImmediate)
+}
+
+func (t ActivationType) String() string {
+	return string(t)
+}
+
+func (t ActivationType) IsUnknown() bool {
+	return !isKnown(t, ActivationNone, ActivationManual, ActivationStopPrice, ActivationStopPricePercent, ActivationOneCancelsOtherStop)
+}
+
+func (c TriggerCondition) String() string {
+	return string(c)
+}
+
+func (c TriggerCondition) IsUnknown() bool {
+	return !isKnown(c, TriggerAtOrBelow, TriggerAtOrAbove)
+}
+
+func (c ResultCode) String() string {
+	return string(c)
+}
+
+func (c ResultCode) IsUnknown() bool {
+	return !isKnown(c, ResultOK)
+}
+
+// Reports if the request was rejected, an empty result code is not a rejection
+func (c ResultCode) IsRejected() bool {
+	return c != "" && c != ResultOK
+}
+
+// Reports if the order can still be traded or changed
+func (o Order) IsOpen() bool {
+	return o.OrderState.IsOpen() && !o.IsTerminal()
+}
+
+// Reports if the order will not change anymore
+func (o Order) IsTerminal() bool {
+	return o.OrderState.IsTerminal() || o.ActionState == DeleteConfirmed || o.ActionState == InsertFailed
+}
+
+// Reports if the last action on the order was rejected
+func (o Order) IsRejected() bool {
+	return o.ActionState.IsRejected()
+}
+
+// Reports if the order request was rejected, by the result code or the action state
+func (r OrderReply) IsRejected() bool {
+	return r.ResultCode.IsRejected() || r.ActionState.IsRejected()
+}
+
+func isKnown[T ~string](v T, known ...T) bool {
+	for _, k := range known {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnumsJSON(t *testing.T) {
+	var order Order
+	raw := `{"side":"BUY","order_state":"ON_MARKET","action_state":"SOMETHING_NEW","validity":{"type":"DAY"},"activation_condition":{"type":"NONE","trigger_condition":"<="}}`
+	assert.NoError(t, json.Unmarshal([]byte(raw), &order))
+
+	assert.Equal(t, Buy, order.Side)
+	assert.Equal(t, OrderOnMarket, order.OrderState)
+	assert.Equal(t, ValidDay, order.Validity.Type)
+	assert.Equal(t, ActivationNone, order.ActivationCondition.Type)
+	assert.Equal(t, TriggerAtOrBelow, order.ActivationCondition.TriggerCondition)
+	assert.False(t, order.OrderState.IsUnknown())
+
+	assert.True(t, order.ActionState.IsUnknown())
+	assert.Equal(t, "SOMETHING_NEW", order.ActionState.String())
+
+	b, err := json.Marshal(order)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"action_state":"SOMETHING_NEW"`)
+	assert.Contains(t, string(b), `"side":"BUY"`)
+}
+
+func TestEnumPredicates(t *testing.T) {
+	assert.Equal(t, 1, Buy.Sign())
+	assert.Equal(t, -1, Sell.Sign())
+	assert.Equal(t, 0, Side("X").Sign())
+
+	assert.True(t, OrderLocal.IsOpen())
+	assert.True(t, OrderDone.IsTerminal())
+	assert.False(t, OrderState("X").IsOpen())
+	assert.False(t, OrderState("X").IsTerminal())
+
+	assert.True(t, ModifyPending.IsPending())
+	assert.True(t, DeleteFailed.IsRejected())
+	assert.False(t, DeleteConfirmed.IsRejected())
+
+	assert.True(t, Order{OrderState: OrderOnMarket, ActionState: ModifyConfirmed}.IsOpen())
+	assert.False(t, Order{OrderState: OrderOnMarket, ActionState: DeleteConfirmed}.IsOpen())
+	assert.True(t, Order{OrderState: OrderOnMarket, ActionState: DeleteConfirmed}.IsTerminal())
+	assert.True(t, Order{OrderState: OrderLocal, ActionState: InsertFailed}.IsRejected())
+	assert.False(t, Order{OrderState: OrderLocal, ActionState: InsertFailed}.IsOpen())
+
+	assert.False(t, OrderReply{ResultCode: ResultOK, ActionState: InsertConfirmed}.IsRejected())
+	assert.True(t, OrderReply{ResultCode: "NEXT_INVALID_PRICE"}.IsRejected())
+	assert.True(t, ResultCode("NEXT_INVALID_PRICE").IsUnknown())
+	assert.True(t, OrderReply{ResultCode: ResultOK, ActionState: InsertFailed}.IsRejected())
+}
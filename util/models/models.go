@@ -1,11 +1,17 @@
 // Package models represents data returned by the API and in the private feed
 package models
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type SystemStatus struct {
-	Timestamp     int64  `json:"timestamp"`
-	ValidVersion  bool   `json:"valid_version"`
-	SystemRunnnig bool   `json:"system_running"`
-	Message       string `json:"message"`
+	Timestamp     Timestamp `json:"timestamp"`
+	ValidVersion  bool      `json:"valid_version"`
+	SystemRunnnig bool      `json:"system_running"`
+	Message       string    `json:"message"`
 }
 
 type Account struct {
@@ -37,7 +43,7 @@ type AccountInfo struct {
 }
 
 type Amount struct {
-	Value    float64 `json:"value"`
+	Value    Decimal `json:"value"`
 	Currency string  `json:"currency"`
 }
 
@@ -65,40 +71,76 @@ type Order struct {
 	Tradable            TradableId          `json:"tradable"`
 	OpenVolume          float64             `json:"open_volume"`
 	TradedVolume        float64             `json:"traded_volume"`
-	Side                string              `json:"side"`
-	Modified            int64               `json:"modified"`
+	Side                Side                `json:"side"`
+	Modified            Timestamp           `json:"modified"`
 	Reference           string              `json:"reference"`
 	ActivationCondition ActivationCondition `json:"activation_condition"`
-	PriceCondition      string              `json:"price_condition"`
-	VolumeCondition     string              `json:"volume_condition"`
+	PriceCondition      PriceCondition      `json:"price_condition"`
+	VolumeCondition     VolumeCondition     `json:"volume_condition"`
 	Validity            Validity            `json:"validity"`
-	ActionState         string              `json:"action_state"`
-	OrderState          string              `json:"order_state"`
+	ActionState         ActionState         `json:"action_state"`
+	OrderState          OrderState          `json:"order_state"`
 }
 
+// TradableId is the canonical identity of a tradable, shared by the REST models and the feed messages.
+// It is comparable and can be used as a map key.
 type TradableId struct {
 	Identifier string `json:"identifier"`
 	MarketId   int64  `json:"market_id"`
 }
 
+// Parses the identifier:market_id format returned by String, e.g. "101:11"
+func ParseTradableId(s string) (TradableId, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 1 {
+		return TradableId{}, fmt.Errorf("Invalid tradable %q, expected identifier:market_id", s)
+	}
+
+	market, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return TradableId{}, fmt.Errorf("Invalid market in tradable %q", s)
+	}
+
+	return TradableId{Identifier: s[:i], MarketId: market}, nil
+}
+
+// Formats the tradable as identifier:market_id, e.g. "101:11"
+func (t TradableId) String() string {
+	return fmt.Sprintf("%s:%d", t.Identifier, t.MarketId)
+}
+
+// Formats the tradable as market_id:identifier, which is the order used in REST URLs
+func (t TradableId) URLParam() string {
+	return fmt.Sprintf("%d:%s", t.MarketId, t.Identifier)
+}
+
+// Reports if the tradable is on the smart order market
+func (t TradableId) IsSmartOrder() bool {
+	return t.MarketId == SmartOrderMarketId
+}
+
+func (o Order) TradableId() TradableId {
+	return o.Tradable
+}
+
 type ActivationCondition struct {
-	Type             string  `json:"type"`
-	TrailingValue    float64 `json:"trailing_value"`
-	TriggerValue     float64 `json:"trigger_value"`
-	TriggerCondition string  `json:"trigger_condition"`
+	Type             ActivationType   `json:"type"`
+	TrailingValue    Decimal          `json:"trailing_value"`
+	TriggerValue     Decimal          `json:"trigger_value"`
+	TriggerCondition TriggerCondition `json:"trigger_condition"`
 }
 
 type Validity struct {
-	Type       string `json:"type"`
-	ValidUntil int64  `json:"valid_until"`
+	Type       ValidityType `json:"type"`
+	ValidUntil Timestamp    `json:"valid_until"`
 }
 
 type OrderReply struct {
-	OrderId     int64  `json:"order_id"`
-	ResultCode  string `json:"result_code"`
-	OrderState  string `json:"order_state"`
-	ActionState string `json:"action_state"`
-	Message     string `json:"message"`
+	OrderId     int64       `json:"order_id"`
+	ResultCode  ResultCode  `json:"result_code"`
+	OrderState  OrderState  `json:"order_state"`
+	ActionState ActionState `json:"action_state"`
+	Message     string      `json:"message"`
 }
 
 type Position struct {
@@ -113,6 +155,11 @@ type Position struct {
 	MorningPrice   Amount     `json:"morning_price"`
 }
 
+// Returns the tradables of the positions instrument
+func (p Position) TradableIds() []TradableId {
+	return p.Instrument.TradableIds()
+}
+
 type Instrument struct {
 	InstrumentId        int64            `json:"instrument_id"`
 	Tradables           []Tradable       `json:"tradables"`
@@ -123,7 +170,7 @@ type Instrument struct {
 	Symbol              string           `json:"symbol"`
 	IsinCode            string           `json:"isin_code"`
 	MarketView          string           `json:"market_view"`
-	StrikePrice         float64          `json:"strike_price"`
+	StrikePrice         Decimal          `json:"strike_price"`
 	NumberOfSecurities  float64          `json:"number_of_securities"`
 	ProspectusUrl       string           `json:"prospectus_url"`
 	ExpirationDate      string           `json:"expiration_date"`
@@ -133,6 +180,14 @@ type Instrument struct {
 	Underlyings         []UnderlyingInfo `json:"underlyings"`
 }
 
+func (i Instrument) TradableIds() []TradableId {
+	res := make([]TradableId, len(i.Tradables))
+	for n, tradable := range i.Tradables {
+		res[n] = tradable.TradableId
+	}
+	return res
+}
+
 type Tradable struct {
 	TradableId
 	TickSizeId   int64   `json:"tick_size_id"`
@@ -153,9 +208,13 @@ type Trade struct {
 	Tradable     TradableId `json:"tradable"`
 	Price        Amount     `json:"price"`
 	Volume       float64    `json:"volume"`
-	Side         string     `json:"side"`
+	Side         Side       `json:"side"`
 	Counterparty string     `json:"counterparty"`
-	Tradetime    int64      `json:"tradetime"`
+	Tradetime    Timestamp  `json:"tradetime"`
+}
+
+func (t Trade) TradableId() TradableId {
+	return t.Tradable
 }
 
 type Country struct {
@@ -163,6 +222,16 @@ type Country struct {
 	Name    string `json:"name"`
 }
 
+// Identifies an indicator as src:identifier, e.g. SIX:OMXS30
+type IndicatorId struct {
+	Src        string `json:"src"`
+	Identifier string `json:"identifier"`
+}
+
+func (i IndicatorId) String() string {
+	return fmt.Sprintf("%s:%s", i.Src, i.Identifier)
+}
+
 type Indicator struct {
 	Name         string `json:"name"`
 	Src          string `json:"src"`
@@ -193,7 +262,7 @@ type Issuer struct {
 }
 
 type OptionPair struct {
-	StrikePrice    float64    `json:"strike_price"`
+	StrikePrice    Decimal    `json:"strike_price"`
 	ExpirationDate string     `json:"expiration_date"`
 	Call           Instrument `json:"call"`
 	Put            Instrument `json:"put"`
@@ -229,6 +298,11 @@ type Feed struct {
 	Encrypted bool   `json:"encrypted"`
 }
 
+// Returns the host:port address to dial
+func (f Feed) Address() string {
+	return fmt.Sprintf("%s:%d", f.Hostname, f.Port)
+}
+
 type LoggedInStatus struct {
 	LoggedIn bool `json:"logged_in"`
 }
@@ -241,6 +315,13 @@ type Login struct {
 	PublicFeed  Feed   `json:"public_feed"`
 }
 
+type LoginChallenge struct {
+	Challenge string `json:"challenge"`
+}
+
+// Market 80 is the smart order market, orders on its tradables are routed with Nordnet's best execution policy
+const SmartOrderMarketId int64 = 80
+
 type Market struct {
 	MarketId int64  `json:"market_id"`
 	Country  string `json:"country"`
@@ -248,24 +329,24 @@ type Market struct {
 }
 
 type NewsPreview struct {
-	NewsId      int64   `json:"news_id"`
-	SourceId    int64   `json:"source_id"`
-	Headline    string  `json:"headline"`
-	Instruments []int64 `json:"instruments"`
-	Lang        string  `json:"lang"`
-	Type        string  `json:"type"`
-	Timestamp   int64   `json:"timestamp"`
+	NewsId      int64     `json:"news_id"`
+	SourceId    int64     `json:"source_id"`
+	Headline    string    `json:"headline"`
+	Instruments []int64   `json:"instruments"`
+	Lang        string    `json:"lang"`
+	Type        string    `json:"type"`
+	Timestamp   Timestamp `json:"timestamp"`
 }
 
 type NewsItem struct {
-	NewsId      int64   `json:"news_id"`
-	SourceId    int64   `json:"source_id"`
-	Headline    string  `json:"headline"`
-	Body        string  `json:"body"`
-	Instruments []int64 `json:"instruments"`
-	Lang        string  `json:"lang"`
-	Type        string  `json:"type"`
-	Timestamp   int64   `json:"timestamp"`
+	NewsId      int64     `json:"news_id"`
+	SourceId    int64     `json:"source_id"`
+	Headline    string    `json:"headline"`
+	Body        string    `json:"body"`
+	Instruments []int64   `json:"instruments"`
+	Lang        string    `json:"lang"`
+	Type        string    `json:"type"`
+	Timestamp   Timestamp `json:"timestamp"`
 }
 
 type NewsSource struct {
@@ -287,9 +368,9 @@ type TicksizeTable struct {
 
 type TickSizeInterval struct {
 	Decimals  int64   `json:"decimals"`
-	FromPrice float64 `json:"from_price"`
-	ToPrice   float64 `json:"to_price"`
-	Tick      float64 `json:"tick"`
+	FromPrice Decimal `json:"from_price"`
+	ToPrice   Decimal `json:"to_price"`
+	Tick      Decimal `json:"tick"`
 }
 
 type TradableInfo struct {
@@ -300,9 +381,9 @@ type TradableInfo struct {
 }
 
 type CalendarDay struct {
-	Date  string `json:"date"`
-	Open  int64  `json:"open"`
-	Close int64  `json:"close"`
+	Date  string    `json:"date"`
+	Open  Timestamp `json:"open"`
+	Close Timestamp `json:"close"`
 }
 
 type OrderType struct {
@@ -316,12 +397,12 @@ type IntradayGraph struct {
 }
 
 type IntradayTick struct {
-	Timestamp  int64   `json:"timestamp"`
-	Last       float64 `json:"last"`
-	Low        float64 `json:"low"`
-	High       float64 `json:"high"`
-	Volume     float64 `json:"volume"`
-	NoOfTrades int64   `json:"no_of_trades"`
+	Timestamp  Timestamp `json:"timestamp"`
+	Last       Decimal   `json:"last"`
+	Low        Decimal   `json:"low"`
+	High       Decimal   `json:"high"`
+	Volume     float64   `json:"volume"`
+	NoOfTrades int64     `json:"no_of_trades"`
 }
 
 type PublicTrades struct {
@@ -330,11 +411,11 @@ type PublicTrades struct {
 }
 
 type PublicTrade struct {
-	BrokerBuying   string  `json:"broker_buying"`
-	BrokerSelling  string  `json:"broker_selling"`
-	Volume         int64   `json:"volume"`
-	Price          float64 `json:"price"`
-	TradeId        string  `json:"trade_id"`
-	TradeType      string  `json:"trade_type"`
-	TradeTimestamp int64   `json:"trade_timestamp"`
+	BrokerBuying   string    `json:"broker_buying"`
+	BrokerSelling  string    `json:"broker_selling"`
+	Volume         int64     `json:"volume"`
+	Price          Decimal   `json:"price"`
+	TradeId        string    `json:"trade_id"`
+	TradeType      string    `json:"trade_type"`
+	TradeTimestamp Timestamp `json:"trade_timestamp"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTradableId(t *testing.T) {
+	id, err := ParseTradableId("101:11")
+	assert.NoError(t, err)
+	assert.Equal(t, TradableId{Identifier: "101", MarketId: 11}, id)
+	assert.Equal(t, "101:11", id.String())
+	assert.Equal(t, "11:101", id.URLParam())
+
+	id, err = ParseTradableId("SE:ABC:80")
+	assert.NoError(t, err)
+	assert.Equal(t, TradableId{Identifier: "SE:ABC", MarketId: 80}, id)
+	assert.True(t, id.IsSmartOrder())
+
+	for _, invalid := range []string{"", "101", ":11", "101:", "101:x"} {
+		_, err = ParseTradableId(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTradableIdAsMapKey(t *testing.T) {
+	order := Order{Tradable: TradableId{"101", 11}}
+	trade := Trade{Tradable: TradableId{"101", 11}}
+
+	seen := map[TradableId]int{order.TradableId(): 1}
+	seen[trade.TradableId()]++
+	assert.Equal(t, map[TradableId]int{{"101", 11}: 2}, seen)
+
+	position := Position{Instrument: Instrument{Tradables: []Tradable{{TradableId: TradableId{"101", 11}}, {TradableId: TradableId{"101", 80}}}}}
+	assert.Equal(t, []TradableId{{"101", 11}, {"101", 80}}, position.TradableIds())
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+)
+
+// Returned when amounts in different currencies are combined
+type CurrencyMismatchError struct {
+	A, B string
+}
+
+// CurrencyMismatchError implements the error interface
+func (e CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("Cannot combine amounts in %s and %s", e.A, e.B)
+}
+
+// Adds the amounts, which must have the same currency. An amount without currency, like the zero
+// Amount, takes the currency of the other so that sums can start from Amount{}.
+func (a Amount) Add(o Amount) (Amount, error) {
+	currency, err := a.currencyWith(o)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{a.Value.Add(o.Value), currency}, nil
+}
+
+// Subtracts o, which must have the same currency
+func (a Amount) Sub(o Amount) (Amount, error) {
+	return a.Add(o.Neg())
+}
+
+// Multiplies the value, e.g. a price with a volume
+func (a Amount) Mul(d Decimal) Amount {
+	return Amount{a.Value.Mul(d), a.Currency}
+}
+
+func (a Amount) Neg() Amount {
+	return Amount{a.Value.Neg(), a.Currency}
+}
+
+func (a Amount) IsZero() bool {
+	return a.Value.IsZero()
+}
+
+// Formats the amount as "12.5 SEK"
+func (a Amount) String() string {
+	if a.Currency == "" {
+		return a.Value.String()
+	}
+	return a.Value.String() + " " + a.Currency
+}
+
+func (a Amount) currencyWith(o Amount) (string, error) {
+	switch {
+	case a.Currency == o.Currency || o.Currency == "":
+		return a.Currency, nil
+	case a.Currency == "":
+		return o.Currency, nil
+	}
+	return "", CurrencyMismatchError{a.Currency, o.Currency}
+}
+
+// Reports if the price is within the interval
+func (i TickSizeInterval) Contains(price Decimal) bool {
+	return price.Cmp(i.FromPrice) >= 0 && price.Cmp(i.ToPrice) <= 0
+}
+
+// Rounds the price to the nearest tick
+func (i TickSizeInterval) Round(price Decimal) Decimal {
+	if i.Tick.IsZero() {
+		return price
+	}
+	return price.Div(i.Tick).Round(0).Mul(i.Tick)
+}
+
+// Formats the price with the decimals of the interval
+func (i TickSizeInterval) Format(price Decimal) string {
+	return price.Format(i.Decimals)
+}
+
+// Returns the interval containing the price
+func (t TicksizeTable) Interval(price Decimal) (TickSizeInterval, bool) {
+	for _, interval := range t.Ticks {
+		if interval.Contains(price) {
+			return interval, true
+		}
+	}
+	return TickSizeInterval{}, false
+}
+
+// Rounds the price to the nearest tick, prices outside the table are returned unchanged
+func (t TicksizeTable) Round(price Decimal) Decimal {
+	if interval, ok := t.Interval(price); ok {
+		return interval.Round(price)
+	}
+	return price
+}
+
+// Formats the price with the decimals of its interval, prices outside the table use the shortest form
+func (t TicksizeTable) Format(price Decimal) string {
+	if interval, ok := t.Interval(price); ok {
+		return interval.Format(price)
+	}
+	return price.String()
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timestamp is a point in time sent as milliseconds since the unix epoch, as used throughout the API and the feeds.
+// It encodes to the same JSON number, and 0 is the zero time.
+type Timestamp int64
+
+// Fixed offsets used when the zoneinfo database is not available, without daylight saving
+var nordicZones = map[string]struct {
+	name   string
+	offset int
+}{
+	"SE": {"Europe/Stockholm", 1},
+	"NO": {"Europe/Oslo", 1},
+	"DK": {"Europe/Copenhagen", 1},
+	"FI": {"Europe/Helsinki", 2},
+}
+
+var locations sync.Map
+
+// Layouts tried when a timestamp is sent as a string
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// Converts the time to a Timestamp, truncating it to milliseconds
+func TimestampOf(t time.Time) Timestamp {
+	if t.IsZero() {
+		return 0
+	}
+	return Timestamp(t.UnixMilli())
+}
+
+// Returns the time in UTC, or the zero time.Time when the timestamp is 0
+func (t Timestamp) Time() time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(t)).UTC()
+}
+
+// Returns the time in the given location
+func (t Timestamp) In(loc *time.Location) time.Time {
+	return t.Time().In(loc)
+}
+
+// Returns the time in the local time of the exchanges in the country, e.g. "SE"
+func (t Timestamp) InCountry(country string) time.Time {
+	return t.In(CountryLocation(country))
+}
+
+func (t Timestamp) IsZero() bool {
+	return t == 0
+}
+
+// Decodes a millisecond number, a quoted number, or a date string like "2015-01-29 11:17:03".
+// Strings without a zone are read as UTC.
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	return t.unmarshalJSON(b, time.UTC)
+}
+
+// SwedishTimestamp is a Timestamp whose date strings without a zone are in Swedish local time
+// instead of UTC, as the news on the public feed are sent. It encodes to a millisecond number.
+type SwedishTimestamp struct {
+	Timestamp
+}
+
+// SwedishTimestamp implements the json.Marshaler interface
+func (t SwedishTimestamp) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(t.Timestamp), 10)), nil
+}
+
+// SwedishTimestamp implements the json.Unmarshaler interface
+func (t *SwedishTimestamp) UnmarshalJSON(b []byte) error {
+	return t.Timestamp.unmarshalJSON(b, CountryLocation("SE"))
+}
+
+func (t *Timestamp) unmarshalJSON(b []byte, loc *time.Location) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+
+	s := string(b)
+	if len(b) > 1 && b[0] == '"' {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return err
+		}
+		if unquoted == "" {
+			*t = 0
+			return nil
+		}
+		if ms, err := strconv.ParseInt(unquoted, 10, 64); err == nil {
+			*t = Timestamp(ms)
+			return nil
+		}
+		parsed, err := ParseTimestamp(unquoted, loc)
+		if err != nil {
+			return err
+		}
+		*t = parsed
+		return nil
+	}
+
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*t = Timestamp(ms)
+		return nil
+	}
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid timestamp %s", s)
+	}
+	*t = Timestamp(ms)
+	return nil
+}
+
+// Parses a date string, strings without a zone are read in loc
+func ParseTimestamp(s string, loc *time.Location) (Timestamp, error) {
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return TimestampOf(parsed), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid timestamp %q", s)
+}
+
+// Returns the time zone of the exchanges in the Nordic country, e.g. "SE", and UTC for other countries.
+// If the zoneinfo database is missing a fixed offset without daylight saving is used.
+func CountryLocation(country string) *time.Location {
+	zone, ok := nordicZones[country]
+	if !ok {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(country); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(zone.name)
+	if err != nil {
+		loc = time.FixedZone(zone.name, zone.offset*60*60)
+	}
+	locations.Store(country, loc)
+	return loc
+}
+
+// Returns the time zone of the market
+func (m Market) Location() *time.Location {
+	return CountryLocation(m.Country)
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTimestampJSON(t *testing.T) {
+	var order Order
+	assert.NoError(t, json.Unmarshal([]byte(`{"modified":1422525423123,"validity":{"valid_until":null}}`), &order))
+	assert.EqualValues(t, 1422525423123, order.Modified)
+	assert.Equal(t, time.Date(2015, 1, 29, 9, 57, 3, 123000000, time.UTC), order.Modified.Time())
+	assert.True(t, order.Validity.ValidUntil.IsZero())
+	assert.True(t, order.Validity.ValidUntil.Time().IsZero())
+
+	b, err := json.Marshal(CalendarDay{Date: "2015-01-29", Open: 1422518400000, Close: 1422549000000})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"date":"2015-01-29","open":1422518400000,"close":1422549000000}`, string(b))
+
+	var ts Timestamp
+	for raw, expected := range map[string]Timestamp{
+		`123`:                         123,
+		`"123"`:                       123,
+		`1.23e2`:                      123,
+		`""`:                          0,
+		`"2015-01-29T09:57:03.123Z"`:  1422525423123,
+		`"2015-01-29 09:57:03"`:       1422525423000,
+		`"2015-01-29T10:57:03+01:00"`: 1422525423000,
+	} {
+		ts = -1
+		assert.NoError(t, json.Unmarshal([]byte(raw), &ts), raw)
+		assert.Equal(t, expected, ts, raw)
+	}
+	assert.Error(t, json.Unmarshal([]byte(`"yesterday"`), &ts))
+}
+
+func TestTimestampLocations(t *testing.T) {
+	ts := TimestampOf(time.Date(2015, 7, 1, 7, 0, 0, 0, time.UTC))
+	assert.Equal(t, Timestamp(1435734000000), ts)
+	assert.Equal(t, Timestamp(0), TimestampOf(time.Time{}))
+
+	if _, err := time.LoadLocation("Europe/Stockholm"); err == nil {
+		// summer time
+		assert.Equal(t, 9, ts.InCountry("SE").Hour())
+		assert.Equal(t, 10, ts.InCountry("FI").Hour())
+	}
+	assert.Equal(t, 7, ts.InCountry("US").Hour())
+	assert.Equal(t, CountryLocation("NO"), Market{Country: "NO"}.Location())
+
+	parsed, err := ParseTimestamp("2015-07-01 09:00:00", CountryLocation("SE"))
+	assert.NoError(t, err)
+	assert.Equal(t, ts.InCountry("SE"), parsed.InCountry("SE"))
+}
+
+func TestSwedishTimestampJSON(t *testing.T) {
+	var ts SwedishTimestamp
+	assert.NoError(t, json.Unmarshal([]byte(`"2015-01-29 10:57:03"`), &ts))
+	assert.Equal(t, time.Date(2015, 1, 29, 9, 57, 3, 0, time.UTC), ts.Time())
+
+	assert.NoError(t, json.Unmarshal([]byte(`1422525423123`), &ts))
+	assert.EqualValues(t, 1422525423123, ts.Timestamp)
+
+	b, err := json.Marshal(ts)
+	assert.NoError(t, err)
+	assert.Equal(t, `1422525423123`, string(b))
+}
@@ -8,20 +8,21 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
-	"fmt"
 	"strconv"
 	"time"
 )
 
 func GenerateCredentials(username, password, rawPem []byte) (cred string, err error) {
-	ms := time.Now().Unix() * 1000
-	unixStr := strconv.FormatInt(ms, 10)
+	return GenerateCredentialsAt(username, password, rawPem, time.Now())
+}
 
-	userBase64 := base64.StdEncoding.EncodeToString(username)
-	passBase64 := base64.StdEncoding.EncodeToString(password)
-	timeBase64 := base64.StdEncoding.EncodeToString([]byte(unixStr))
+// Same as GenerateCredentials but stamps the given time, used to compensate for a skewed local clock.
+func GenerateCredentialsAt(username, password, rawPem []byte, now time.Time) (cred string, err error) {
+	ms := now.Unix() * 1000
+	unixStr := strconv.FormatInt(ms, 10)
 
-	formated := fmt.Sprintf("%s:%s:%s", userBase64, passBase64, timeBase64)
+	formated := encodeCredentials(username, password, []byte(unixStr))
+	defer Zero(formated)
 
 	block, _ := pem.Decode(rawPem)
 	if block == nil {
@@ -40,7 +41,7 @@ func GenerateCredentials(username, password, rawPem []byte) (cred string, err er
 		return
 	}
 
-	encr, err := rsa.EncryptPKCS1v15(rand.Reader, rsaPubKey, []byte(formated))
+	encr, err := rsa.EncryptPKCS1v15(rand.Reader, rsaPubKey, formated)
 	if err != nil {
 		return
 	}
@@ -48,3 +49,34 @@ func GenerateCredentials(username, password, rawPem []byte) (cred string, err er
 	cred = base64.StdEncoding.EncodeToString(encr)
 	return
 }
+
+// Zero overwrites the buffer with zeroes, used to clear secrets after use.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Builds the base64(user):base64(pass):base64(timestamp) blob in a buffer that can be zeroed
+func encodeCredentials(username, password, timestamp []byte) []byte {
+	enc := base64.StdEncoding
+	parts := [][]byte{username, password, timestamp}
+
+	size := len(parts) - 1
+	for _, part := range parts {
+		size += enc.EncodedLen(len(part))
+	}
+
+	buf := make([]byte, size)
+	pos := 0
+	for i, part := range parts {
+		if i > 0 {
+			buf[pos] = ':'
+			pos++
+		}
+		enc.Encode(buf[pos:], part)
+		pos += enc.EncodedLen(len(part))
+	}
+
+	return buf
+}
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	vaultVersion    = 1
+	vaultIterations = 200000
+	vaultSaltSize   = 16
+	vaultKeySize    = 32
+)
+
+var (
+	VaultPassphraseError = errors.New("Could not open vault, wrong passphrase or corrupt file")
+	VaultIterationsError = errors.New("Vault key derivation iterations below the minimum")
+)
+
+// On disk format of the vault, the payload is the AES-GCM encrypted vaultPayload
+type vaultFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Payload    []byte `json:"payload"`
+}
+
+type vaultPayload struct {
+	Username []byte `json:"username"`
+	Password []byte `json:"password"`
+	Pem      []byte `json:"pem"`
+}
+
+// VaultProvider reads the secrets from a passphrase protected vault file created by WriteVault.
+// The file is decrypted on every call so the secrets only live in memory while logging in.
+type VaultProvider struct {
+	Path string
+
+	// Called on every login to get the passphrase, the returned buffer is zeroed after use
+	Passphrase func() ([]byte, error)
+}
+
+// VaultProvider implements the CredentialProvider interface
+func (p *VaultProvider) Credentials() (string, error) {
+	return p.CredentialsAt(time.Now())
+}
+
+// VaultProvider implements the TimedCredentialProvider interface
+func (p *VaultProvider) CredentialsAt(now time.Time) (string, error) {
+	passphrase, err := p.Passphrase()
+	if err != nil {
+		return "", err
+	}
+	defer Zero(passphrase)
+
+	s, err := OpenVault(p.Path, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return s.credentials(now)
+}
+
+// Encrypts the secrets with a key derived from the passphrase and writes them to path
+func WriteVault(path string, passphrase []byte, s *Secrets) (err error) {
+	vf := vaultFile{
+		Version:    vaultVersion,
+		Iterations: vaultIterations,
+		Salt:       make([]byte, vaultSaltSize),
+	}
+	if _, err = rand.Read(vf.Salt); err != nil {
+		return
+	}
+
+	gcm, err := vaultCipher(passphrase, vf.Salt, vf.Iterations)
+	if err != nil {
+		return
+	}
+
+	vf.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(vf.Nonce); err != nil {
+		return
+	}
+
+	plain, err := json.Marshal(&vaultPayload{s.Username, s.Password, s.Pem})
+	if err != nil {
+		return
+	}
+	defer Zero(plain)
+
+	vf.Payload = gcm.Seal(nil, vf.Nonce, plain, nil)
+
+	data, err := json.Marshal(&vf)
+	if err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Decrypts the vault at path, the caller should Zero the returned secrets when done
+func OpenVault(path string, passphrase []byte) (*Secrets, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	vf := vaultFile{}
+	if err = json.Unmarshal(data, &vf); err != nil {
+		return nil, err
+	}
+	if vf.Version != vaultVersion {
+		return nil, errors.New("Unsupported vault version")
+	}
+	// A tampered file could lower the iterations to make the passphrase cheap to brute force
+	if vf.Iterations < vaultIterations {
+		return nil, VaultIterationsError
+	}
+
+	gcm, err := vaultCipher(passphrase, vf.Salt, vf.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := gcm.Open(nil, vf.Nonce, vf.Payload, nil)
+	if err != nil {
+		return nil, VaultPassphraseError
+	}
+	defer Zero(plain)
+
+	payload := vaultPayload{}
+	if err = json.Unmarshal(plain, &payload); err != nil {
+		return nil, err
+	}
+
+	return &Secrets{payload.Username, payload.Password, payload.Pem}, nil
+}
+
+func vaultCipher(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	key := pbkdf2.Key(passphrase, salt, iterations, vaultKeySize, sha256.New)
+	defer Zero(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}